@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+)
+
+var accountsPath = flag.String("accounts", "accounts.json", "file the server keeps player accounts and their characters in; empty lets anyone play without logging in")
+
+// Password hashing: PBKDF2 with SHA-256, salted per account. Accounts keep
+// the iteration count they were hashed with, so raising it doesn't lock
+// anyone out.
+var hashIterations = 100000
+
+const (
+	saltLength = 16
+	hashLength = 32
+)
+
+// Account names are this long at most, and passwords this short at least.
+const (
+	maxNameLength     = 16
+	minPasswordLength = 4
+)
+
+// Account is a player's login, and the character they play.
+type Account struct {
+	Name       string
+	Salt       []byte
+	Hash       []byte
+	Iterations int
+	// The character as it was when they last left; nil once it's died,
+	// for a new one next time.
+	Character *SavedCharacter `json:",omitempty"`
+}
+
+// SavedCharacter is a player's entity between connections, and the depth
+// of the level it was on.
+type SavedCharacter struct {
+	Depth  int
+	Entity SavedEntity
+}
+
+func hashPassword(password string, salt []byte, iterations int) []byte {
+	hash, err := pbkdf2.Key(sha256.New, password, salt, iterations, hashLength)
+	if err != nil {
+		panic(fmt.Errorf("Couldn't hash a password: %v", err))
+	}
+	return hash
+}
+
+// checkName reports what's wrong with an account name, if anything.
+func checkName(name string) error {
+	if name == "" || len(name) > maxNameLength {
+		return fmt.Errorf("names are 1 to %v letters long", maxNameLength)
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return fmt.Errorf("names are letters, digits, - and _")
+		}
+	}
+	return nil
+}
+
+/*
+ *  AccountStore struct and methods.
+ */
+
+// The AccountStore is every account, kept in a file that's rewritten on
+// each change. It also knows who's logged in, so nobody plays the same
+// character twice at once.
+type AccountStore struct {
+	path     string
+	accounts map[string]*Account
+	loggedIn map[string]bool
+	mutex    sync.Mutex
+}
+
+// The server's accounts, or nil if anyone may play without logging in.
+var accounts *AccountStore
+
+// LoadAccounts opens the account store in path, empty if there's no such
+// file yet.
+func LoadAccounts(path string) (*AccountStore, error) {
+	a := &AccountStore{path: path, accounts: map[string]*Account{}, loggedIn: map[string]bool{}}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []*Account
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("%v:%v", path, err)
+	}
+	for _, acct := range list {
+		a.accounts[acct.Name] = acct
+	}
+	return a, nil
+}
+
+// save writes out the store; call it with the mutex held.
+func (a *AccountStore) save() error {
+	var list []*Account
+	for _, acct := range a.accounts {
+		list = append(list, acct)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	data, err := json.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return err
+	}
+	if err := replaceFile(a.path, data); err != nil {
+		return fmt.Errorf("%v:%v", a.path, err)
+	}
+	return nil
+}
+
+// Exists reports whether there's an account called name.
+func (a *AccountStore) Exists(name string) bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	_, ok := a.accounts[name]
+	return ok
+}
+
+// Register makes a new account and logs it in.
+func (a *AccountStore) Register(name, password string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("passwords are at least %v letters long", minPasswordLength)
+	}
+	salt := make([]byte, saltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return err
+	}
+	acct := &Account{Name: name, Salt: salt, Iterations: hashIterations}
+	acct.Hash = hashPassword(password, salt, acct.Iterations)
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if _, ok := a.accounts[name]; ok {
+		return fmt.Errorf("%v is taken", name)
+	}
+	a.accounts[name] = acct
+	if err := a.save(); err != nil {
+		delete(a.accounts, name)
+		return err
+	}
+	a.loggedIn[name] = true
+	return nil
+}
+
+// Login checks name's password and logs it in.
+func (a *AccountStore) Login(name, password string) error {
+	a.mutex.Lock()
+	acct, ok := a.accounts[name]
+	a.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("no account called %v", name)
+	}
+	// Hashing is slow on purpose, so it's done without holding up the
+	// rest of the store.
+	hash := hashPassword(password, acct.Salt, acct.Iterations)
+	if subtle.ConstantTimeCompare(hash, acct.Hash) != 1 {
+		return fmt.Errorf("wrong password")
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.loggedIn[name] {
+		return fmt.Errorf("%v is already logged in", name)
+	}
+	a.loggedIn[name] = true
+	return nil
+}
+
+// Logout lets name log in again.
+func (a *AccountStore) Logout(name string) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	delete(a.loggedIn, name)
+}
+
+// Character returns name's character, or nil if they need a new one.
+func (a *AccountStore) Character(name string) *SavedCharacter {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	acct, ok := a.accounts[name]
+	if !ok {
+		panic(fmt.Errorf("Looked for non-existent account: %v", name))
+	}
+	return acct.Character
+}
+
+// SetCharacter keeps c as name's character, nil for a new one next time.
+func (a *AccountStore) SetCharacter(name string, c *SavedCharacter) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	acct, ok := a.accounts[name]
+	if !ok {
+		panic(fmt.Errorf("Looked for non-existent account: %v", name))
+	}
+	acct.Character = c
+	return a.save()
+}
+
+// SetCharacters keeps each account's character in characters at once.
+func (a *AccountStore) SetCharacters(characters map[string]*SavedCharacter) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	for name, c := range characters {
+		acct, ok := a.accounts[name]
+		if !ok {
+			panic(fmt.Errorf("Looked for non-existent account: %v", name))
+		}
+		acct.Character = c
+	}
+	return a.save()
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAccountStore(t *testing.T) {
+	defer func(n int) { hashIterations = n }(hashIterations)
+	hashIterations = 1000
+	path := filepath.Join(t.TempDir(), "accounts.json")
+	a, err := LoadAccounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "has space", "waytoolongforanaccountname"} {
+		if err := a.Register(name, "hunter2"); err == nil {
+			t.Errorf("registered bad name %q", name)
+		}
+	}
+	if err := a.Register("bob", "abc"); err == nil {
+		t.Errorf("registered a too short password")
+	}
+	if err := a.Register("bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Register("bob", "hunter3"); err == nil {
+		t.Errorf("registered bob twice")
+	}
+	if err := a.Login("bob", "hunter2"); err == nil {
+		t.Errorf("logged in twice at once")
+	}
+	a.Logout("bob")
+	if err := a.Login("bob", "hunter3"); err == nil {
+		t.Errorf("logged in with the wrong password")
+	}
+	c := &SavedCharacter{Depth: 2, Entity: SavedEntity{Components: PositionComponent, Position: Position{3, 4}}}
+	if err := a.SetCharacter("bob", c); err != nil {
+		t.Fatal(err)
+	}
+
+	// It's all still there when the store's opened again.
+	a, err = LoadAccounts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Login("bob", "hunter2"); err != nil {
+		t.Errorf("can't log in after reopening: %v", err)
+	}
+	if got := a.Character("bob"); got == nil || got.Depth != 2 || got.Entity.Position != (Position{3, 4}) {
+		t.Errorf("bob's character is %+v after reopening, want %+v", got, c)
+	}
+}
+
+func TestCharacter_Resumes(t *testing.T) {
+	aiTestLevel(t, 1, 1)
+	defer world.Unload()
+	startGameLoop(t)
+
+	player := joinPlayer(nil)
+	if player == nil {
+		t.Fatal("no room for the player")
+	}
+	gameLoop.Do(func() {
+		player.Predicates["Movement"].Pick(MoveRight)
+		player.SetHealth(Health{HP: 4, MaxHP: 10})
+	})
+	at, _ := player.Position()
+	c, ok := leavePlayer(player)
+	if !ok || c == nil {
+		t.Fatalf("leaving gave character %v, ok %v; want the character", c, ok)
+	}
+
+	back := joinPlayer(c)
+	if p, _ := back.Position(); p != at {
+		t.Errorf("resumed at %v, want where it left at %v", p, at)
+	}
+	if h, _ := back.Health(); h.HP != 4 {
+		t.Errorf("resumed with %v HP, want 4", h.HP)
+	}
+
+	// Dead characters aren't kept.
+	gameLoop.Do(func() { back.Level().RemoveEntity(back) })
+	if c, ok := leavePlayer(back); !ok || c != nil {
+		t.Errorf("leaving dead gave character %v, ok %v; want none", c, ok)
+	}
+}
+
+func TestLogin_Registers(t *testing.T) {
+	defer func(n int) { hashIterations = n }(hashIterations)
+	hashIterations = 1000
+	var err error
+	defer func(a *AccountStore) { accounts = a }(accounts)
+	if accounts, err = LoadAccounts(filepath.Join(t.TempDir(), "accounts.json")); err != nil {
+		t.Fatal(err)
+	}
+	aiTestLevel(t, 1, 1)
+	defer world.Unload()
+	startGameLoop(t)
+
+	// A new name, then a password with a space in it, twice.
+	tbox := termbox.NewClient()
+	typed := strings.NewReader("bob\rpass word\rpass word\r")
+	if err := tbox.InitRemote(typed, ioutil.Discard, 80, 24); err != nil {
+		t.Fatal(err)
+	}
+	defer tbox.Close()
+	if name := login(tbox, nil); name != "bob" {
+		t.Fatalf("login gave %q, want bob", name)
+	}
+	accounts.Logout("bob")
+	if err := accounts.Login("bob", "pass word"); err != nil {
+		t.Errorf("can't log in with the password typed: %v", err)
+	}
+}
+
+func TestCharacter_KeptWhilePlaying(t *testing.T) {
+	defer func(n int) { hashIterations = n }(hashIterations)
+	hashIterations = 1000
+	var err error
+	defer func(a *AccountStore) { accounts = a }(accounts)
+	if accounts, err = LoadAccounts(filepath.Join(t.TempDir(), "accounts.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.Register("bob", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+	mf, err := ParseMapFile(strings.NewReader(worldTestMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := mf.NewLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	world = NewWorld(top, 1)
+	defer world.Unload()
+	GlobalRNG = NewRNG(1)
+	GlobalMessages = NewMessages()
+	startGameLoop(t)
+	player := makeEntity(2, 1, '@')
+	player.StartAI("player")
+	gameLoop.Do(func() { top.RegisterEntity(player) })
+	s := &Session{Name: "bob", Player: player}
+
+	// Going down the stairs keeps the character on its new level.
+	gameLoop.Do(func() { s.climb(ClimbDown) })
+	if c := accounts.Character("bob"); c == nil || c.Depth != 1 {
+		t.Fatalf("kept %+v after going down, want a character on depth 1", c)
+	}
+
+	// So does an autosave, until the character dies.
+	gameLoop.Do(func() {
+		player.SetHealth(Health{HP: 3, MaxHP: 10})
+		keepCharacters([]*Session{s})
+	})
+	if c := accounts.Character("bob"); c == nil || c.Entity.Health.HP != 3 {
+		t.Errorf("kept %+v after an autosave, want 3 HP", c)
+	}
+	gameLoop.Do(func() {
+		player.Level().RemoveEntity(player)
+		keepCharacters([]*Session{s})
+	})
+	if c := accounts.Character("bob"); c != nil {
+		t.Errorf("kept %+v after dying, want none", c)
+	}
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"shogun/pathfind"
+)
+
+// How many tiles a monster's path search may look at before it gives up on
+// reaching somewhere.
+const pathLimit = 2000
+
+// Monsters whose HP falls to 1/fleeFraction of their MaxHP run from the
+// players they can see.
+const fleeFraction = 3
+
+/*
+ *  AI interface and registry.
+ */
+
+// An AI decides what an entity does with its turns. Decide is asked once a
+// turn, while the scheduler waits on the entity, and should look at the
+// world only through the View it's given.
+type AI interface {
+	Decide(v *View) Decision
+}
+
+// An AI can implement Stopper to hear that its entity has left play, by
+// dying or by its level being unloaded. Stop is the last call it gets.
+type Stopper interface {
+	Stop()
+}
+
+// A Decision is what an entity does with a turn: the name of one of its
+// Predicates, and the option to pick.
+type Decision struct {
+	Predicate string
+	Option    int
+}
+
+// Wait is the Decision to let a turn pass.
+var Wait = Decision{"Movement", MoveWait}
+
+// Step is the Decision to move one tile by dx, dy; only their signs
+// count.
+func Step(dx, dy int) Decision {
+	moves := [3][3]int{
+		{MoveUpLeft, MoveUp, MoveUpRight},
+		{MoveLeft, MoveWait, MoveRight},
+		{MoveDownLeft, MoveDown, MoveDownRight},
+	}
+	return Decision{"Movement", moves[sign(dy)+1][sign(dx)+1]}
+}
+
+func sign(i int) int {
+	switch {
+	case i < 0:
+		return -1
+	case i > 0:
+		return 1
+	}
+	return 0
+}
+
+// Perform carries out d.
+func (e *Entity) Perform(d Decision) {
+	p, ok := e.Predicates[d.Predicate]
+	if !ok {
+		panic(fmt.Errorf("Looked for non-existent predicate: %v", d.Predicate))
+	}
+	p.Pick(d.Option)
+}
+
+// AIs maps the names entities are saved and spawned with to constructors
+// for their AI. Every entity gets an AI of its own, so AIs may remember
+// things between turns.
+var AIs = map[string]func() AI{}
+
+// RegisterAI adds an AI to AIs. It panics on a reused name, since that's
+// always a programming error.
+func RegisterAI(name string, new func() AI) {
+	if _, ok := AIs[name]; ok {
+		panic(fmt.Errorf("Registered AI twice: %v", name))
+	}
+	AIs[name] = new
+}
+
+func init() {
+	RegisterAI("random", func() AI { return RandomAI{} })
+	RegisterAI("idle", func() AI { return IdleAI{} })
+	RegisterAI("hunter", func() AI { return &HunterAI{} })
+	RegisterAI("wander", func() AI { return &WanderAI{} })
+	// Players act on their session's input, not on their turns.
+	RegisterAI("player", func() AI { return IdleAI{} })
+}
+
+// runAI asks ai for e's every turn until e leaves play.
+func runAI(e *Entity, ai AI) {
+	for {
+		token, ok := e.WaitTurn()
+		if !ok {
+			break
+		}
+		d := ai.Decide(&View{level: e.Level(), self: e})
+		e.TakeTurn(token, func() { e.Perform(d) })
+	}
+	if s, ok := ai.(Stopper); ok {
+		s.Stop()
+	}
+}
+
+/*
+ *  View struct and methods.
+ */
+
+// A View is the world as an AI sees it on one turn: its entity's level,
+// to look at but not change. The EntityViews it hands out carry their
+// Entity only to tell entities apart.
+type View struct {
+	level *Level
+	self  *Entity
+	// Computed on first use.
+	fov *FOV
+}
+
+// Self is the entity the AI is deciding for.
+func (v *View) Self() EntityView {
+	return viewOf(v.self)
+}
+
+// TileAt returns the terrain at x, y, and ok if that's on the map.
+func (v *View) TileAt(x, y int) (Tile, bool) {
+	t, ok := v.level.TileAt(x, y)
+	if !ok {
+		return Tile{}, false
+	}
+	return *t, true
+}
+
+// EntitiesAt returns the entities standing at x, y.
+func (v *View) EntitiesAt(x, y int) []EntityView {
+	var ret []EntityView
+	for _, e := range v.level.GetEntity(x, y) {
+		ret = append(ret, viewOf(e))
+	}
+	return ret
+}
+
+// CanSee reports whether x, y is in the entity's field of view.
+func (v *View) CanSee(x, y int) bool {
+	if v.fov == nil {
+		pos, _ := v.self.Position()
+		stats, _ := v.self.Stats()
+		v.fov = ComputeFOV(v.level, pos.X, pos.Y, stats.Sight)
+	}
+	return v.fov.Visible(x, y)
+}
+
+// NearestPlayer returns the closest player the entity can see, by the same
+// measure paths use, and ok if there is one.
+func (v *View) NearestPlayer() (EntityView, bool) {
+	pos, ok := v.self.Position()
+	if !ok {
+		return EntityView{}, false
+	}
+	stats, _ := v.self.Stats()
+	var best EntityView
+	bestDist := -1
+	for _, other := range v.level.EntitiesWithin(pos.X, pos.Y, stats.Sight) {
+		if other.AIName() != "player" || other.Dead() {
+			continue
+		}
+		p, _ := other.Position()
+		if !v.CanSee(p.X, p.Y) {
+			continue
+		}
+		d := pathfind.Distance(pathfind.Point{X: pos.X, Y: pos.Y}, pathfind.Point{X: p.X, Y: p.Y})
+		if bestDist == -1 || d < bestDist {
+			best, bestDist = viewOf(other), d
+		}
+	}
+	return best, bestDist != -1
+}
+
+// PointsOfInterest is Level.PointsOfInterest.
+func (v *View) PointsOfInterest() []Point {
+	return v.level.PointsOfInterest()
+}
+
+// Passable reports whether the entity could step onto x, y: terrain it can
+// cross, with nobody else standing there.
+func (v *View) Passable(x, y int) bool {
+	return levelGrid{v.level, v.self, pathfind.Point{X: -1, Y: -1}}.Passable(x, y)
+}
+
+// PathTo returns the shortest path from the entity to x, y, around
+// terrain and other entities except whoever stands on x, y itself, and ok
+// if there is one.
+func (v *View) PathTo(x, y int) ([]pathfind.Point, bool) {
+	pos, ok := v.self.Position()
+	if !ok {
+		return nil, false
+	}
+	goal := pathfind.Point{X: x, Y: y}
+	return pathfind.Find(levelGrid{v.level, v.self, goal}, pathfind.Point{X: pos.X, Y: pos.Y}, goal, pathLimit)
+}
+
+// levelGrid is a Level as a pathfind.Grid for one entity: tiles it may
+// stand on, without anyone else in the way. The goal is always passable,
+// since moving into an entity attacks it.
+type levelGrid struct {
+	l    *Level
+	e    *Entity
+	goal pathfind.Point
+}
+
+func (g levelGrid) Passable(x, y int) bool {
+	t, ok := g.l.TileAt(x, y)
+	if !ok || !t.Passable(g.e) {
+		return false
+	}
+	if x == g.goal.X && y == g.goal.Y {
+		return true
+	}
+	for _, other := range g.l.GetEntity(x, y) {
+		if other != g.e {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ *  Decisions the AIs share.
+ */
+
+// stepToward is the Decision to take one step along the path to x, y,
+// attacking whatever stands there once it's adjacent. ok reports whether
+// there was a path to follow.
+func stepToward(v *View, x, y int) (d Decision, ok bool) {
+	path, ok := v.PathTo(x, y)
+	if !ok || len(path) == 0 {
+		return Wait, false
+	}
+	pos := v.Self().Position
+	return Step(path[0].X-pos.X, path[0].Y-pos.Y), true
+}
+
+// fleeFrom is the Decision to step to whichever neighbouring tile is
+// farthest from threat, by the same measure paths use. Cornered, it turns
+// and fights.
+func fleeFrom(v *View, threat EntityView) Decision {
+	pos, tp := v.Self().Position, threat.Position
+	from := pathfind.Point{X: tp.X, Y: tp.Y}
+	bestDX, bestDY := 0, 0
+	best := pathfind.Distance(pathfind.Point{X: pos.X, Y: pos.Y}, from)
+	for _, d := range [][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}, {-1, -1}, {1, -1}, {-1, 1}, {1, 1}} {
+		x, y := pos.X+d[0], pos.Y+d[1]
+		if !v.Passable(x, y) {
+			continue
+		}
+		if dist := pathfind.Distance(pathfind.Point{X: x, Y: y}, from); dist > best {
+			best, bestDX, bestDY = dist, d[0], d[1]
+		}
+	}
+	if bestDX == 0 && bestDY == 0 {
+		d, _ := stepToward(v, tp.X, tp.Y)
+		return d
+	}
+	return Step(bestDX, bestDY)
+}
+
+// wounded reports whether an entity is hurt badly enough to run.
+func wounded(e EntityView) bool {
+	return e.Components&HealthComponent != 0 && e.Health.HP*fleeFraction <= e.Health.MaxHP
+}
+
+/*
+ *  AIs.
+ */
+
+// RandomAI stumbles about.
+type RandomAI struct{}
+
+func (RandomAI) Decide(v *View) Decision {
+	// Roll 1d9: one of the eight directions, or stay put.
+	return Decision{"Movement", roll(1, 9)}
+}
+
+// IdleAI lets its turns pass.
+type IdleAI struct{}
+
+func (IdleAI) Decide(v *View) Decision {
+	return Wait
+}
+
+// HunterAI chases the nearest player it can see and attacks it. When it
+// loses sight of its quarry it searches where it was last seen; when badly
+// hurt it runs away instead.
+type HunterAI struct {
+	lastSeen *Position
+}
+
+func (h *HunterAI) Decide(v *View) Decision {
+	target, seen := v.NearestPlayer()
+	if seen && wounded(v.Self()) {
+		return fleeFrom(v, target)
+	}
+	if seen {
+		h.lastSeen = &target.Position
+	}
+	if h.lastSeen == nil {
+		return Wait
+	}
+	if v.Self().Position == *h.lastSeen {
+		h.lastSeen = nil
+		return Wait
+	}
+	d, ok := stepToward(v, h.lastSeen.X, h.lastSeen.Y)
+	if !ok {
+		h.lastSeen = nil
+	}
+	return d
+}
+
+// WanderAI walks between the level's points of interest, picking the next
+// at random on arrival. It keeps out of fights, and runs from players when
+// badly hurt.
+type WanderAI struct {
+	dest *Point
+}
+
+func (w *WanderAI) Decide(v *View) Decision {
+	self := v.Self()
+	if target, seen := v.NearestPlayer(); seen && wounded(self) {
+		return fleeFrom(v, target)
+	}
+	pos := self.Position
+	if w.dest == nil || (Point{pos.X, pos.Y}) == *w.dest {
+		pois := v.PointsOfInterest()
+		if len(pois) == 0 {
+			return Wait
+		}
+		p := pois[GlobalRNG.Intn(len(pois))]
+		w.dest = &p
+	}
+	// Somebody standing on the destination would be attacked, so stop
+	// short and pick another. Diagonal neighbours count: that's a step too.
+	if v.EntitiesAt(w.dest.X, w.dest.Y) != nil && max(abs(pos.X-w.dest.X), abs(pos.Y-w.dest.Y)) <= 1 {
+		w.dest = nil
+		return Wait
+	}
+	d, ok := stepToward(v, w.dest.X, w.dest.Y)
+	if !ok {
+		w.dest = nil
+	}
+	return d
+}
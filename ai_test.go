@@ -0,0 +1,185 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const aiTestMap = `
+MAP
+##########
+#........#
+#.####...#
+#........#
+##########
+ENDMAP
+START: (1,1)
+`
+
+// aiTestLevel makes the test map the world's only level, with a player at
+// x, y.
+func aiTestLevel(t *testing.T, x, y int) (*Level, *Entity) {
+	mf, err := ParseMapFile(strings.NewReader(aiTestMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := mf.NewLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	world = NewWorld(l, 1)
+	GlobalRNG = NewRNG(1)
+	GlobalMessages = NewMessages()
+	player := makeEntity(x, y, '@')
+	player.StartAI("player")
+	l.RegisterEntity(player)
+	return l, player
+}
+
+func TestHunterAI_Chases(t *testing.T) {
+	level, player := aiTestLevel(t, 1, 1)
+	hunter := makeEntity(8, 1, 'r')
+	hunter.StartAI("hunter")
+	level.RegisterEntity(hunter)
+	defer level.Unload()
+
+	for i := 0; i < 6; i++ {
+		level.Tick()
+	}
+	p, _ := hunter.Position()
+	if p != (Position{2, 1}) {
+		t.Fatalf("hunter at %v after 6 turns, want next to the player", p)
+	}
+	// It may miss a few times.
+	for i := 0; i < 20; i++ {
+		if h, _ := player.Health(); h.HP < h.MaxHP {
+			return
+		}
+		level.Tick()
+	}
+	t.Errorf("hunter never hurt the player")
+}
+
+func TestHunterAI_Flees(t *testing.T) {
+	level, _ := aiTestLevel(t, 1, 1)
+	hunter := makeEntity(3, 1, 'r')
+	hunter.SetHealth(Health{HP: 1, MaxHP: 10})
+	hunter.StartAI("hunter")
+	level.RegisterEntity(hunter)
+	defer level.Unload()
+
+	for i := 0; i < 3; i++ {
+		level.Tick()
+	}
+	p, _ := hunter.Position()
+	if d := abs(p.X-1) + abs(p.Y-1); d <= 2 {
+		t.Errorf("wounded hunter at %v, want it to have run", p)
+	}
+}
+
+// stopAI counts its turns, and notes when it's stopped.
+type stopAI struct {
+	turns   int
+	stopped bool
+}
+
+func (s *stopAI) Decide(v *View) Decision {
+	s.turns++
+	return Wait
+}
+
+func (s *stopAI) Stop() {
+	s.stopped = true
+}
+
+func TestAI_Stops(t *testing.T) {
+	ai := &stopAI{}
+	RegisterAI("test-stop", func() AI { return ai })
+	defer delete(AIs, "test-stop")
+
+	level, player := aiTestLevel(t, 1, 1)
+	e := makeEntity(8, 3, 'x')
+	e.StartAI("test-stop")
+	level.RegisterEntity(e)
+	level.Tick()
+	level.Tick()
+
+	level.Unload()
+	if ai.turns != 2 {
+		t.Errorf("AI had %v turns, want 2", ai.turns)
+	}
+	if !ai.stopped {
+		t.Errorf("AI wasn't stopped when its level was unloaded")
+	}
+	if !player.Dead() {
+		t.Errorf("player still in play after unload")
+	}
+}
+
+// slowAI steps right, but takes too long deciding to.
+type slowAI struct{}
+
+func (slowAI) Decide(v *View) Decision {
+	time.Sleep(2 * turnTimeout)
+	return Step(1, 0)
+}
+
+func TestScheduler_DropsLateActions(t *testing.T) {
+	RegisterAI("test-slow", func() AI { return slowAI{} })
+	defer delete(AIs, "test-slow")
+
+	level, _ := aiTestLevel(t, 1, 1)
+	e := makeEntity(4, 3, 's')
+	e.StartAI("test-slow")
+	level.RegisterEntity(e)
+	defer level.Unload()
+
+	level.Tick()
+	// Long enough for the AI to decide, after the turn's been forfeited.
+	time.Sleep(3 * turnTimeout)
+	if p, _ := e.Position(); p != (Position{4, 3}) {
+		t.Errorf("slow AI moved to %v after its turn was over, want it still at 4,3", p)
+	}
+}
+
+func TestWanderAI_KeepsOutOfFights(t *testing.T) {
+	level, _ := aiTestLevel(t, 1, 1)
+	defer level.Unload()
+	level.POIs = []Point{{7, 2}}
+	wanderer := makeEntity(6, 3, 'w')
+	level.RegisterEntity(wanderer)
+	// Standing on the wanderer's destination, a diagonal step away.
+	blocker := makeEntity(7, 2, 'b')
+	level.RegisterEntity(blocker)
+
+	ai := &WanderAI{}
+	if d := ai.Decide(&View{level: level, self: wanderer}); d != Wait {
+		t.Errorf("wanderer next to its occupied destination decided %+v, want to wait", d)
+	}
+
+	wanderer.StartAI("wander")
+	for i := 0; i < 10; i++ {
+		level.Tick()
+	}
+	if h, _ := blocker.Health(); h.HP != h.MaxHP {
+		t.Errorf("wanderer attacked the entity on its destination, leaving it %v/%v HP", h.HP, h.MaxHP)
+	}
+}
+
+func TestView_NearestPlayer(t *testing.T) {
+	// Three steps straight along the corridor, against two diagonal ones
+	// that are further by Manhattan distance.
+	level, _ := aiTestLevel(t, 8, 1)
+	defer level.Unload()
+	diagonal := makeEntity(7, 3, '@')
+	diagonal.StartAI("player")
+	level.RegisterEntity(diagonal)
+	hunter := makeEntity(5, 1, 'h')
+	level.RegisterEntity(hunter)
+
+	got, ok := (&View{level: level, self: hunter}).NearestPlayer()
+	if !ok || got.Entity != diagonal {
+		t.Errorf("nearest player is at %v, want the one two steps away at (7,3)", got.Position)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Unarmed damage, before the strength bonus.
+var fistDamage = MustParseDice("1d4")
+
+// Attack resolves one melee attack by attacker on defender. The attacker
+// hits if d20 plus its to-hit bonus reaches the defender's AC; a hit does
+// its weapon's damage plus a strength bonus. A defender brought to 0 HP
+// dies and is removed from the level. Entities without Health can't be
+// hurt, and are left alone.
+func Attack(attacker, defender *Entity) {
+	if !defender.Has(HealthComponent) {
+		return
+	}
+	a, d := attacker.Name(), defender.Name()
+	stats, _ := defender.Stats()
+	if roll(1, 20)+strengthBonus(attacker) < stats.AC {
+		GlobalMessages.Broadcast(fmt.Sprintf("%v misses %v.", a, d))
+		return
+	}
+
+	damage := attacker.WeaponDamage().Roll(GlobalRNG) + strengthBonus(attacker)
+	if damage < 1 {
+		damage = 1
+	}
+	health, _ := defender.UpdateHealth(func(h *Health) { h.HP -= damage })
+	GlobalMessages.Broadcast(fmt.Sprintf("%v hits %v for %v.", a, d, damage))
+
+	// Only the blow that takes the defender past 0 kills it, in case two
+	// attackers land at once. Whatever it carried falls where it stood.
+	if health.HP <= 0 && health.HP+damage > 0 {
+		GlobalMessages.Broadcast(fmt.Sprintf("%v dies.", d))
+		pos, _ := defender.Position()
+		l := defender.Level()
+		for item := defender.RemoveFromInventory(0); item != nil; item = defender.RemoveFromInventory(0) {
+			l.AddItem(pos.X, pos.Y, item)
+		}
+		l.RemoveEntity(defender)
+	}
+}
+
+// strengthBonus is +1 for every full 3 points of Str above 5, and -1 for
+// every full 3 below. Entities without Stats get none.
+func strengthBonus(e *Entity) int {
+	stats, ok := e.Stats()
+	if !ok {
+		return 0
+	}
+	return (stats.Str - 5) / 3
+}
@@ -0,0 +1,94 @@
+package main
+
+import "testing"
+
+func TestStrengthBonus(t *testing.T) {
+	// Only full 3 points away from 5 count, either way: the division
+	// truncating towards zero is what keeps Str 3 and 4 at no penalty.
+	for _, test := range []struct{ str, want int }{
+		{5, 0}, {7, 0}, {8, 1}, {11, 2}, {4, 0}, {3, 0}, {2, -1}, {-1, -2},
+	} {
+		e := newEntity()
+		e.SetStats(Stats{Str: test.str})
+		if got := strengthBonus(e); got != test.want {
+			t.Errorf("Str %v gives bonus %v, want %v", test.str, got, test.want)
+		}
+	}
+	if got := strengthBonus(newEntity()); got != 0 {
+		t.Errorf("no Stats gives bonus %v, want 0", got)
+	}
+}
+
+func TestAttack(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		str  int
+		ac   int
+		// The damage each attack may do; 0 to 0 for a miss.
+		min, max int
+	}{
+		{"AC 1 is always hit", 5, 1, 1, 4},
+		{"AC 21 is never hit", 5, 21, 0, 0},
+		{"strength adds to damage", 11, 1, 3, 6},
+		{"weak attackers hit for at least 1", -25, -100, 1, 1},
+		{"weak attackers miss more", 2, 20, 0, 0},
+	} {
+		level, _ := aiTestLevel(t, 1, 1)
+		GlobalRNG = NewRNG(1)
+		attacker := makeEntity(4, 3, 'a')
+		attacker.SetStats(Stats{AC: 10, Str: test.str})
+		level.RegisterEntity(attacker)
+		// Plenty of attacks, on a defender who can take them all.
+		defender := makeEntity(5, 3, 'd')
+		defender.SetStats(Stats{AC: test.ac})
+		level.RegisterEntity(defender)
+		for i := 0; i < 50; i++ {
+			defender.SetHealth(Health{HP: 100, MaxHP: 100})
+			Attack(attacker, defender)
+			h, _ := defender.Health()
+			if damage := 100 - h.HP; damage < test.min || damage > test.max {
+				t.Errorf("%v: attack %v did %v damage, want %v to %v", test.name, i, damage, test.min, test.max)
+				break
+			}
+		}
+		level.Unload()
+	}
+}
+
+func TestAttack_Kills(t *testing.T) {
+	if err := LoadItemDefs(*itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	level, _ := aiTestLevel(t, 1, 1)
+	defer level.Unload()
+	attacker := makeEntity(4, 3, 'a')
+	level.RegisterEntity(attacker)
+	defender := makeEntity(5, 3, 'd')
+	defender.SetStats(Stats{AC: 1})
+	defender.SetHealth(Health{HP: 1, MaxHP: 10})
+	for _, name := range []string{"dagger", "potion of healing"} {
+		item, _ := NewItem(name, 1)
+		defender.AddToInventory(item)
+	}
+	level.RegisterEntity(defender)
+
+	Attack(attacker, defender)
+	if !defender.Dead() {
+		t.Fatalf("defender survived a hit at 1 HP")
+	}
+	for _, e := range level.ListEntities() {
+		if e == defender {
+			t.Errorf("dead defender still on the level")
+		}
+	}
+	if got := level.GetEntity(5, 3); got != nil {
+		t.Errorf("spatial index still has %v where the defender died", got)
+	}
+	pile := level.ItemsAt(5, 3)
+	if len(pile) != 2 || pile[0].Def.Name != "dagger" || pile[1].Def.Name != "potion of healing" {
+		t.Errorf("dropped %v where the defender died, want its dagger and potion", pile)
+	}
+	if item := defender.InventoryItem(0); item != nil {
+		t.Errorf("dead defender still carries %v", item)
+	}
+}
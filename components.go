@@ -0,0 +1,250 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+)
+
+// A ComponentSet names some of the component types, for asking which an
+// entity has.
+type ComponentSet uint
+
+const (
+	PositionComponent ComponentSet = 1 << iota
+	HealthComponent
+	StatsComponent
+	RenderableComponent
+	AIComponent
+	InventoryComponent
+)
+
+/*
+ *  Components.
+ */
+
+// Position is where an entity stands on its level.
+type Position struct {
+	X, Y int
+}
+
+// Health is how much damage an entity can take before it dies.
+type Health struct {
+	HP, MaxHP int
+}
+
+// Stats are an entity's abilities, and the energy it has saved up to act.
+type Stats struct {
+	AC, Str int
+	// Swimmers can cross Swimmable tiles.
+	Swim  int
+	Sight int
+	// Speed is energy gained per turn; see the scheduler.
+	Speed, Energy int
+}
+
+// Renderable is how an entity is drawn.
+type Renderable struct {
+	Symbol rune
+	Fg     termbox.Attribute
+}
+
+// AIController names the AI driving an entity, a key of AIs. Only entities
+// with one get turns.
+type AIController struct {
+	Name string
+}
+
+// Inventory is what an entity carries, shown to players as slots a, b,
+// c...
+type Inventory struct {
+	Items   []*Item
+	Wielded *Item
+}
+
+/*
+ *  Component access on Entity.
+ */
+
+// Components returns the set of components the entity has.
+func (e *Entity) Components() ComponentSet {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	var set ComponentSet
+	if e.position != nil {
+		set |= PositionComponent
+	}
+	if e.health != nil {
+		set |= HealthComponent
+	}
+	if e.stats != nil {
+		set |= StatsComponent
+	}
+	if e.renderable != nil {
+		set |= RenderableComponent
+	}
+	if e.ai != nil {
+		set |= AIComponent
+	}
+	if e.inventory != nil {
+		set |= InventoryComponent
+	}
+	return set
+}
+
+// Has reports whether the entity has every component in set.
+func (e *Entity) Has(set ComponentSet) bool {
+	return e.Components()&set == set
+}
+
+// Detach removes the components in set from the entity. Take an entity
+// off its level before detaching its Position, or the level's spatial
+// index will still have it.
+func (e *Entity) Detach(set ComponentSet) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if set&PositionComponent != 0 {
+		e.position = nil
+	}
+	if set&HealthComponent != 0 {
+		e.health = nil
+	}
+	if set&StatsComponent != 0 {
+		e.stats = nil
+	}
+	if set&RenderableComponent != 0 {
+		e.renderable = nil
+	}
+	if set&AIComponent != 0 {
+		e.ai = nil
+	}
+	if set&InventoryComponent != 0 {
+		e.inventory = nil
+	}
+}
+
+// The getters return a copy of the component, and ok if the entity has
+// one. The setters attach the component if it's missing.
+
+func (e *Entity) Position() (Position, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.position == nil {
+		return Position{}, false
+	}
+	return *e.position, true
+}
+
+// SetPosition places an entity that isn't on a level yet; Level.MoveEntity
+// moves one that is.
+func (e *Entity) SetPosition(p Position) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.position = &p
+}
+
+func (e *Entity) Health() (Health, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.health == nil {
+		return Health{}, false
+	}
+	return *e.health, true
+}
+
+func (e *Entity) SetHealth(h Health) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.health = &h
+}
+
+// UpdateHealth changes the entity's Health with f in one step, so
+// concurrent changes aren't lost, and returns the result. It does nothing
+// to an entity without Health.
+func (e *Entity) UpdateHealth(f func(*Health)) (Health, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.health == nil {
+		return Health{}, false
+	}
+	f(e.health)
+	return *e.health, true
+}
+
+func (e *Entity) Stats() (Stats, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.stats == nil {
+		return Stats{}, false
+	}
+	return *e.stats, true
+}
+
+func (e *Entity) SetStats(s Stats) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.stats = &s
+}
+
+// UpdateStats is UpdateHealth for Stats.
+func (e *Entity) UpdateStats(f func(*Stats)) (Stats, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.stats == nil {
+		return Stats{}, false
+	}
+	f(e.stats)
+	return *e.stats, true
+}
+
+func (e *Entity) Renderable() (Renderable, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.renderable == nil {
+		return Renderable{}, false
+	}
+	return *e.renderable, true
+}
+
+func (e *Entity) SetRenderable(r Renderable) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.renderable = &r
+}
+
+func (e *Entity) AIController() (AIController, bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.ai == nil {
+		return AIController{}, false
+	}
+	return *e.ai, true
+}
+
+// AIName is the name of the AI driving the entity, or "" if it has none.
+func (e *Entity) AIName() string {
+	c, _ := e.AIController()
+	return c.Name
+}
+
+// Name is what messages call the entity: its symbol, for now.
+func (e *Entity) Name() string {
+	if r, ok := e.Renderable(); ok {
+		return string(r.Symbol)
+	}
+	return "something"
+}
+
+/*
+ *  Component queries on Level.
+ */
+
+// Query returns the level's entities that have every component in set, in
+// registration order.
+func (l *Level) Query(set ComponentSet) []*Entity {
+	var ret []*Entity
+	for _, e := range l.ListEntities() {
+		if e.Has(set) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
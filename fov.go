@@ -0,0 +1,197 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+	"sync"
+)
+
+// How far entities see, unless their Sight attribute says otherwise.
+const defaultSight = 12
+
+// Remembered tiles are drawn in dark grey: xterm 256 color 240, which is
+// attribute 241 in termbox's Output256 mode.
+const rememberedColor = termbox.Attribute(241)
+
+/*
+ *  Field of view.
+ */
+
+// FOV is the set of tiles visible from one spot.
+type FOV struct {
+	width, height int
+	visible       []bool
+}
+
+// The quadrants of the view, facing north, south, east and west: each
+// takes a tile depth rows out from the viewer and col columns across to
+// its offset from the viewer.
+var quadrants = [4]func(depth, col int) (int, int){
+	func(depth, col int) (int, int) { return col, -depth },
+	func(depth, col int) (int, int) { return col, depth },
+	func(depth, col int) (int, int) { return depth, col },
+	func(depth, col int) (int, int) { return -depth, col },
+}
+
+// ComputeFOV works out what can be seen from (x, y) out to radius tiles,
+// by symmetric shadowcasting over each quadrant. Opaque tiles are visible
+// but hide what's behind them; so is everything off the map. Between
+// floor tiles sight is symmetric: if a can see b, b can see a, so nothing
+// gets to watch a player who can't see it back.
+func ComputeFOV(l *Level, x, y, radius int) *FOV {
+	f := &FOV{height: len(l.Game)}
+	if f.height > 0 {
+		f.width = len(l.Game[0])
+	}
+	f.visible = make([]bool, f.width*f.height)
+	f.mark(x, y)
+	for _, q := range quadrants {
+		f.scan(l, x, y, radius, q, 1, slope{-1, 1}, slope{1, 1})
+	}
+	return f
+}
+
+// A slope is the fraction num/den, with den > 0. They're kept exact, since
+// the symmetry depends on ties coming out the same from either end.
+type slope struct{ num, den int }
+
+// tileSlope is the slope to the near left corner of a tile.
+func tileSlope(depth, col int) slope {
+	return slope{2*col - 1, 2 * depth}
+}
+
+// floorDiv divides rounding down, rather than towards zero.
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && (a < 0) != (b < 0) {
+		q--
+	}
+	return q
+}
+
+// scan lights the row depth tiles out in one quadrant between the start
+// and end slopes, and carries on into the next row past the gaps it finds.
+// Opaque tiles are lit wherever the light reaches them, but others only
+// if their centre is in the light, which is what makes it symmetric. See
+// "Symmetric Shadowcasting" by Albert Ford.
+func (f *FOV) scan(l *Level, x, y, radius int, quadrant func(depth, col int) (int, int), depth int, start, end slope) {
+	if depth > radius {
+		return
+	}
+	// The columns whose centres are in the light, rounding ties outwards.
+	minCol := floorDiv(2*depth*start.num+start.den, 2*start.den)
+	maxCol := -floorDiv(end.den-2*depth*end.num, 2*end.den)
+	wasOpaque := false
+	for col := minCol; col <= maxCol; col++ {
+		dx, dy := quadrant(depth, col)
+		t, ok := l.TileAt(x+dx, y+dy)
+		opaque := !ok || t.Opaque
+		centred := col*start.den >= depth*start.num && col*end.den <= depth*end.num
+		if (opaque || centred) && dx*dx+dy*dy < radius*radius {
+			f.mark(x+dx, y+dy)
+		}
+		if col > minCol && wasOpaque && !opaque {
+			start = tileSlope(depth, col)
+		}
+		if col > minCol && !wasOpaque && opaque {
+			f.scan(l, x, y, radius, quadrant, depth+1, start, tileSlope(depth, col))
+		}
+		wasOpaque = opaque
+	}
+	if minCol <= maxCol && !wasOpaque {
+		f.scan(l, x, y, radius, quadrant, depth+1, start, end)
+	}
+}
+
+func (f *FOV) mark(x, y int) {
+	if x >= 0 && y >= 0 && x < f.width && y < f.height {
+		f.visible[y*f.width+x] = true
+	}
+}
+
+func (f *FOV) Visible(x, y int) bool {
+	if x < 0 || y < 0 || x >= f.width || y >= f.height {
+		return false
+	}
+	return f.visible[y*f.width+x]
+}
+
+/*
+ *  TileMemory struct and methods.
+ */
+
+// TileMemory is what a player has seen of a level: the last glyph seen at
+// each tile, or 0 where they've never looked.
+type TileMemory struct {
+	Width, Height int
+	Glyphs        []byte
+	mutex         sync.Mutex
+}
+
+func NewTileMemory(l *Level) *TileMemory {
+	m := &TileMemory{Height: len(l.Game)}
+	if m.Height > 0 {
+		m.Width = len(l.Game[0])
+	}
+	m.Glyphs = make([]byte, m.Width*m.Height)
+	return m
+}
+
+// Remember records everything in fov.
+func (m *TileMemory) Remember(l *Level, fov *FOV) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for y := 0; y < m.Height && y < fov.height; y++ {
+		for x := 0; x < m.Width && x < fov.width; x++ {
+			if fov.Visible(x, y) {
+				m.Glyphs[y*m.Width+x] = l.Game[y][x]
+			}
+		}
+	}
+}
+
+// Recall returns the glyph last seen at x, y, and ok if there is one.
+func (m *TileMemory) Recall(x, y int) (byte, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if x < 0 || y < 0 || x >= m.Width || y >= m.Height {
+		return 0, false
+	}
+	g := m.Glyphs[y*m.Width+x]
+	return g, g != 0
+}
+
+// Rows returns the memory as one string per row, with unseen tiles as
+// spaces, for saving.
+func (m *TileMemory) Rows() []string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	rows := make([]string, m.Height)
+	for y := range rows {
+		row := make([]byte, m.Width)
+		for x := range row {
+			row[x] = m.Glyphs[y*m.Width+x]
+			if row[x] == 0 {
+				row[x] = ' '
+			}
+		}
+		rows[y] = string(row)
+	}
+	return rows
+}
+
+// TileMemoryFromRows is the inverse of Rows.
+func TileMemoryFromRows(rows []string) *TileMemory {
+	m := &TileMemory{Height: len(rows)}
+	if m.Height > 0 {
+		m.Width = len(rows[0])
+	}
+	m.Glyphs = make([]byte, m.Width*m.Height)
+	for y, row := range rows {
+		for x := 0; x < len(row) && x < m.Width; x++ {
+			if row[x] != ' ' {
+				m.Glyphs[y*m.Width+x] = row[x]
+			}
+		}
+	}
+	return m
+}
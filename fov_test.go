@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+// fovTestLevel is a level with the given rows as its map.
+func fovTestLevel(rows ...string) *Level {
+	l := &Level{}
+	for _, row := range rows {
+		l.Game = append(l.Game, []byte(row))
+	}
+	return l
+}
+
+func TestFOV_Symmetric(t *testing.T) {
+	l := fovTestLevel(
+		"##############",
+		"#............#",
+		"#..#.....#...#",
+		"#......#.....#",
+		"#.#..........#",
+		"#.....##...#.#",
+		"#............#",
+		"##############",
+	)
+	var floor []Point
+	fovs := map[Point]*FOV{}
+	for y, row := range l.Game {
+		for x, c := range row {
+			if c == '.' {
+				p := Point{x, y}
+				floor = append(floor, p)
+				fovs[p] = ComputeFOV(l, x, y, defaultSight)
+			}
+		}
+	}
+	for _, a := range floor {
+		for _, b := range floor {
+			if ab, ba := fovs[a].Visible(b.X, b.Y), fovs[b].Visible(a.X, a.Y); ab != ba {
+				t.Errorf("%v sees %v: %v, but %v sees %v: %v", a, b, ab, b, a, ba)
+			}
+		}
+	}
+}
+
+func TestFOV_WallsBlockSight(t *testing.T) {
+	l := fovTestLevel(
+		"#######",
+		"#..#..#",
+		"#..#..#",
+		"#######",
+	)
+	fov := ComputeFOV(l, 1, 1, defaultSight)
+	for _, test := range []struct {
+		x, y int
+		want bool
+	}{
+		{1, 1, true},  // where it stands
+		{2, 2, true},  // its side of the wall
+		{3, 1, true},  // the wall itself
+		{0, 0, true},  // the corner
+		{4, 1, false}, // behind the wall
+		{5, 2, false},
+		{-1, 0, false}, // off the map
+	} {
+		if got := fov.Visible(test.x, test.y); got != test.want {
+			t.Errorf("(%v,%v) visible: %v, want %v", test.x, test.y, got, test.want)
+		}
+	}
+
+	// Sight stops short of the radius.
+	l = fovTestLevel("#......#")
+	fov = ComputeFOV(l, 1, 0, 3)
+	if !fov.Visible(3, 0) || fov.Visible(4, 0) {
+		t.Errorf("radius 3 sees 2 tiles away: %v, 3 tiles away: %v; want true, false", fov.Visible(3, 0), fov.Visible(4, 0))
+	}
+}
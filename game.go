@@ -1,10 +1,9 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
 	"github.com/sillsm/pseudo-termbox-go"
-	"math/rand"
 	"os"
 	"sync"
 	"time"
@@ -29,8 +28,6 @@ var game = [][]byte{
 	[]byte("---------------------------------------------------------------------------"),
 }
 
-var tbox *termbox.TermClient
-
 // Move Up
 // Attack Monster (null)
 // Drink Potion
@@ -47,71 +44,191 @@ type Predicate struct {
  *  Entity Struct and methods.
  */
 
+// An Entity is anything that lives on a level. What it is and can do
+// depends on which components it has; see components.go.
 type Entity struct {
-	Attributes map[string]int
 	Predicates map[string]Predicate
-	Tock       chan bool
+	// The scheduler sends a turn's token on Tock to give the entity's AI
+	// that turn.
+	Tock chan int
 	// Events can get transmitted to Entities.
 	// Event functions are executed before other statements in an Entity's loop.
 	Events chan func()
-	Symbol rune
-	mutex  sync.Mutex
+	// What the entity has seen of each level, by depth.
+	Memories map[int]*TileMemory
+
+	// Components, nil when the entity doesn't have them. Guarded by mutex.
+	position   *Position
+	health     *Health
+	stats      *Stats
+	renderable *Renderable
+	ai         *AIController
+	inventory  *Inventory
+	// The level the entity is on, or was on when it left play.
+	level *Level
+	mutex sync.Mutex
+
+	// turn is the token of the turn the AI may act on, 0 when it has none;
+	// turns counts the tokens handed out. turnMutex guards both, and is held
+	// while the AI acts, so the scheduler can't move on halfway through an
+	// action. The AI pokes turnDone after finishing a turn.
+	turn      int
+	turns     int
+	turnMutex sync.Mutex
+	turnDone  chan struct{}
+	// stop is closed when the entity leaves play, aiExited when its AI
+	// goroutine returns.
+	stop     chan struct{}
+	stopOnce sync.Once
+	aiExited chan struct{}
 }
 
-func (e *Entity) GetAttribute(s string) int {
+// LevelMemory returns the entity's memory of l, starting one if needed.
+func (e *Entity) LevelMemory(l *Level) *TileMemory {
 	e.mutex.Lock()
-	i, ok := e.Attributes[s]
-	e.mutex.Unlock()
-	if !ok {
-		panic(fmt.Errorf("Looked for non-existent attribute: %v", s))
+	defer e.mutex.Unlock()
+	if e.Memories == nil {
+		e.Memories = map[int]*TileMemory{}
 	}
-	return i
+	if e.Memories[l.Depth] == nil {
+		e.Memories[l.Depth] = NewTileMemory(l)
+	}
+	return e.Memories[l.Depth]
 }
 
-func (e *Entity) SetAttribute(s string, i int) {
+// Level returns the level the entity is on, or was on when it left play,
+// or nil if it's never been on one.
+func (e *Entity) Level() *Level {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.level
+}
+
+// StartAI attaches an AIController for the named AI and runs a new one of
+// it for the entity in its own goroutine, until the entity leaves play.
+func (e *Entity) StartAI(name string) {
+	newAI, ok := AIs[name]
+	if !ok {
+		panic(fmt.Errorf("Started non-existent AI: %v", name))
+	}
+	ai := newAI()
 	e.mutex.Lock()
-	e.Attributes[s] = i
+	e.ai = &AIController{Name: name}
 	e.mutex.Unlock()
+	e.aiExited = make(chan struct{})
+	go func() {
+		defer close(e.aiExited)
+		runAI(e, ai)
+	}()
 }
 
-/*
- *  Messages struct and methods.
- */
-type Messages struct {
-	messages []string
-	location int
+// WaitTurn blocks until the scheduler hands the AI a turn, and returns the
+// turn's token for TakeTurn. ok is false once the entity has left play, and
+// the AI should return.
+func (e *Entity) WaitTurn() (token int, ok bool) {
+	select {
+	case token = <-e.Tock:
+		return token, true
+	case <-e.stop:
+		return 0, false
+	}
 }
 
-func (m *Messages) Broadcast(mes string) {
-	m.messages = append(m.messages, mes)
-	m.location += 1
+// TakeTurn carries out action as the AI's turn token, and ends the turn. If
+// the scheduler has already given up on that turn, the game has moved on
+// without the AI, so action is dropped and TakeTurn returns false.
+func (e *Entity) TakeTurn(token int, action func()) bool {
+	e.turnMutex.Lock()
+	if e.turn != token {
+		e.turnMutex.Unlock()
+		return false
+	}
+	action()
+	e.turn = 0
+	e.turnMutex.Unlock()
+	select {
+	case e.turnDone <- struct{}{}:
+	default:
+	}
+	return true
 }
-func (m *Messages) Display() string {
-	return m.messages[m.location]
+
+// beginTurn hands out a new turn token, which the AI may act on until
+// endTurn.
+func (e *Entity) beginTurn() int {
+	e.turnMutex.Lock()
+	defer e.turnMutex.Unlock()
+	e.turns++
+	e.turn = e.turns
+	return e.turn
+}
+
+// turnTaken reports whether the AI has finished turn token.
+func (e *Entity) turnTaken(token int) bool {
+	e.turnMutex.Lock()
+	defer e.turnMutex.Unlock()
+	return e.turn != token
+}
+
+// endTurn takes back the AI's turn, waiting for an action it's in the
+// middle of.
+func (e *Entity) endTurn() {
+	e.turnMutex.Lock()
+	defer e.turnMutex.Unlock()
+	e.turn = 0
+}
+
+// Stop takes the entity out of play and shuts down its AI.
+func (e *Entity) Stop() {
+	e.stopOnce.Do(func() { close(e.stop) })
+}
+
+// Dead reports whether the entity has been taken out of play.
+func (e *Entity) Dead() bool {
+	select {
+	case <-e.stop:
+		return true
+	default:
+		return false
+	}
 }
 
 /*
  *  Level Struct and methods.
  */
 type Level struct {
-	Game     [][]byte
+	Name string
+	// How far down the world the level is; see World.
+	Depth int
+	Game  [][]byte
+	// Where players join the level, and where wandering monsters go.
+	Starts   []Point
+	POIs     []Point
 	Entities []*Entity
+	// Items lying on the map, top of each pile last.
+	Items     map[Point][]*Item
+	Scheduler Scheduler
+	// Entities by position; see spatial.go.
+	index *SpatialIndex
+	// Guards Entities, Items and index; players join and leave from their
+	// own goroutines.
+	mutex sync.Mutex
 }
 
+// Tick runs one game turn on the level; World.Tick decides which levels
+// get one. AIs act outside the level lock, since they want to look up
+// other entities while the rest are still waiting. Only entities with an
+// AIController and Stats take turns.
 func (l *Level) Tick() {
-	for _, e := range l.Entities {
-		e.Tock <- true
-	}
+	l.Scheduler.Tick(l.Query(AIComponent | StatsComponent))
 }
 
-func (l *Level) GetEntity(x, y int) []*Entity {
-	var ret []*Entity
-	for _, e := range l.Entities {
-		if e.GetAttribute("xpos") == x && e.GetAttribute("ypos") == y {
-			ret = append(ret, e)
-		}
-	}
-	return ret
+// ListEntities returns a copy of the level's entities, safe to range over
+// while other goroutines register and remove entities.
+func (l *Level) ListEntities() []*Entity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*Entity(nil), l.Entities...)
 }
 
 // Get tile returns the rune at location, and ok if location exists.
@@ -127,239 +244,482 @@ func (l *Level) GetTile(x, y int) (rune, bool) {
 	return rune(l.Game[y][x]), true
 }
 
+// TileAt describes the terrain at location, and ok if location exists and
+// holds a registered tile.
+func (l *Level) TileAt(x, y int) (*Tile, bool) {
+	r, ok := l.GetTile(x, y)
+	if !ok {
+		return nil, false
+	}
+	t, ok := Tiles[byte(r)]
+	return t, ok
+}
+
 func (l *Level) RegisterEntity(e *Entity) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	// Build the index before adding e, or e would be indexed twice.
+	index := l.spatial()
 	l.Entities = append(l.Entities, e)
+	if p, ok := e.Position(); ok {
+		index.Insert(e, p)
+	}
+	e.mutex.Lock()
+	e.level = l
+	e.mutex.Unlock()
+}
+
+// RemoveEntity takes e off the level and out of play.
+func (l *Level) RemoveEntity(e *Entity) {
+	l.unregister(e)
+	e.Stop()
+}
+
+// unregister takes e off the level, leaving it in play to go elsewhere.
+func (l *Level) unregister(e *Entity) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	for i, other := range l.Entities {
+		if other == e {
+			l.Entities = append(l.Entities[:i], l.Entities[i+1:]...)
+			if p, ok := e.Position(); ok {
+				l.spatial().Remove(e, p)
+			}
+			break
+		}
+	}
+}
+
+// Unload takes every entity on the level out of play and waits for their
+// AIs to stop, so nothing is left running once the level is dropped.
+func (l *Level) Unload() {
+	entities := l.ListEntities()
+	for _, e := range entities {
+		e.Stop()
+	}
+	for _, e := range entities {
+		<-e.aiExited
+	}
+}
+
+func (l *Level) AddItem(x, y int, item *Item) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.Items == nil {
+		l.Items = map[Point][]*Item{}
+	}
+	p := Point{x, y}
+	l.Items[p] = append(l.Items[p], item)
+}
+
+// ItemsAt returns the pile of items at x, y, top last.
+func (l *Level) ItemsAt(x, y int) []*Item {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*Item(nil), l.Items[Point{x, y}]...)
+}
+
+// TakeItem removes and returns the i'th item at x, y, or nil if there's no
+// such item.
+func (l *Level) TakeItem(x, y, i int) *Item {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	p := Point{x, y}
+	pile := l.Items[p]
+	if i < 0 || i >= len(pile) {
+		return nil
+	}
+	item := pile[i]
+	pile = append(pile[:i], pile[i+1:]...)
+	if len(pile) == 0 {
+		delete(l.Items, p)
+	} else {
+		l.Items[p] = pile
+	}
+	return item
+}
+
+// OpenTileNear finds the walkable tile closest to (x, y) that no entity is
+// standing on. Used to place players joining a crowded level.
+func (l *Level) OpenTileNear(x, y int) (int, int, bool) {
+	best := -1
+	bx, by := 0, 0
+	for row := range l.Game {
+		for col := range l.Game[row] {
+			if !l.IsOpen(col, row) {
+				continue
+			}
+			d := abs(col-x) + abs(row-y)
+			if best == -1 || d < best {
+				best, bx, by = d, col, row
+			}
+		}
+	}
+	return bx, by, best != -1
+}
+
+// SpawnPoint picks where a joining player appears: the first free START
+// point, or failing that the open tile nearest the first one.
+func (l *Level) SpawnPoint() (int, int, bool) {
+	for _, p := range l.Starts {
+		if l.IsOpen(p.X, p.Y) {
+			return p.X, p.Y, true
+		}
+	}
+	if len(l.Starts) == 0 {
+		return 0, 0, false
+	}
+	return l.OpenTileNear(l.Starts[0].X, l.Starts[0].Y)
+}
+
+// PointsOfInterest returns where wandering monsters go: the level's POIs,
+// or its START points if it has none.
+func (l *Level) PointsOfInterest() []Point {
+	if len(l.POIs) > 0 {
+		return l.POIs
+	}
+	return l.Starts
+}
+
+// IsOpen reports whether a player could be put at x, y: walkable and
+// unoccupied.
+func (l *Level) IsOpen(x, y int) bool {
+	t, ok := l.TileAt(x, y)
+	return ok && t.Walkable && l.GetEntity(x, y) == nil
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
 }
 
-var level *Level
 var GlobalMessages *Messages
-var Player *Entity
+var GlobalRNG *RNG
 
 // how many dice, sides.
 func roll(num int, sides int) int {
-	ret := 0
-	// New seed.
-	s1 := rand.NewSource(time.Now().UnixNano())
-	r1 := rand.New(s1)
-	for i := 0; i < num; i++ {
-		ret += r1.Intn(sides) + 1
-	}
-	return ret
+	return GlobalRNG.Roll(num, sides)
 }
 
-func drawGame(l *Level) {
+// drawGame renders a frame of the level into tbox as seen by viewer.
+func drawGame(tbox *termbox.TermClient, f *Frame, viewer *Entity) {
+	l := f.Level
+	frame := animationFrame()
+
 	// Draw Messages
-	for i, c := range GlobalMessages.Display() {
-		tbox.SetCell(i, 0, c, termbox.ColorWhite, termbox.ColorBlack)
-	}
+	drawMessages(tbox, f, viewer)
 
-	// Draw Map
-	rowOffset := 5
-	for row, _ := range l.Game {
-		for col, r := range l.Game[row] {
-			// Coloration, crude animation
-			var fg, bg int
-			var ch rune
-			switch r {
-			case '~':
-				bg = int(termbox.ColorBlack)
-				fg = int(termbox.ColorBlue)
-				ch = '~'
-				if i := roll(1, 10); i == 10 {
-					ch = '≈'
+	// Work out what the viewer can see, and remember it. A dead viewer
+	// isn't in the frame, but still sees from where it fell.
+	v, ok := f.View(viewer)
+	if !ok {
+		v.Position, _ = viewer.Position()
+		v.Stats, _ = viewer.Stats()
+		v.Health, _ = viewer.Health()
+	}
+	vx, vy := v.Position.X, v.Position.Y
+	vstats, vhealth := v.Stats, v.Health
+	fov := ComputeFOV(l, vx, vy, vstats.Sight)
+	memory := viewer.LevelMemory(l)
+	memory.Remember(l, fov)
+
+	// Draw Map below the messages, leaving a line at the bottom for stats.
+	rowOffset := messagePaneLines + 1
+	w, h := tbox.Size()
+	view := NewViewport(l, vx, vy, 0, rowOffset, w, h-rowOffset-1)
+	if view.Height > len(l.Game) {
+		view.Height = len(l.Game)
+	}
+	for row := view.Y; row < view.Y+view.Height; row++ {
+		for col := view.X; col < view.X+view.Width && col < len(l.Game[row]); col++ {
+			r := l.Game[row][col]
+			sx, sy, _ := view.ToScreen(col, row)
+			if !fov.Visible(col, row) {
+				// Fog of war: what was seen here last, dimmed and still.
+				if g, ok := memory.Recall(col, row); ok {
+					tbox.SetCell(sx, sy, rune(g), rememberedColor, termbox.ColorBlack)
 				}
-			default:
-				bg = int(termbox.ColorBlack)
-				fg = int(termbox.ColorWhite)
-				ch = rune(r)
+				continue
+			}
+			// Coloration, crude animation
+			t, ok := Tiles[r]
+			if !ok {
+				tbox.SetCell(sx, sy, rune(r), termbox.ColorWhite, termbox.ColorBlack)
+				continue
 			}
+			tbox.SetCell(sx, sy, t.Rune(col, row, frame), t.Fg, t.Bg)
+		}
+	}
 
-			tbox.SetCell(col, row+rowOffset, ch, termbox.Attribute(fg), termbox.Attribute(bg))
+	// Draw Items, the top of each pile.
+	for row := view.Y; row < view.Y+view.Height; row++ {
+		for col := view.X; col < view.X+view.Width; col++ {
+			if !fov.Visible(col, row) {
+				continue
+			}
+			if symbol, ok := f.Items[Point{col, row}]; ok {
+				sx, sy, _ := view.ToScreen(col, row)
+				tbox.SetCell(sx, sy, symbol, termbox.ColorYellow, termbox.ColorBlack)
+			}
 		}
 	}
 
 	// Draw Entities
-	for _, e := range l.Entities {
-		x := e.GetAttribute("xpos")
-		y := e.GetAttribute("ypos")
-		tbox.SetCell(x, y+rowOffset, e.Symbol, termbox.ColorWhite, termbox.ColorBlack)
-
+	for _, e := range f.EntitiesInRect(view.X, view.Y, view.Width, view.Height) {
+		p, r := e.Position, e.Renderable
+		if e.Components&RenderableComponent == 0 || !fov.Visible(p.X, p.Y) {
+			continue
+		}
+		x, y, _ := view.ToScreen(p.X, p.Y)
+		tbox.SetCell(x, y, r.Symbol, r.Fg, termbox.ColorBlack)
 	}
 
 	// Draw Player Stats
-	statOffset := rowOffset + len(l.Game)
-	stats := fmt.Sprintf("AC: %v\t HP:%v\t Str:%v\t", Player.GetAttribute("AC"), Player.GetAttribute("HP"), Player.GetAttribute("Str"))
+	statOffset := rowOffset + view.Height
+	stats := fmt.Sprintf("Dlvl:%v\t AC: %v\t HP:%v\t Str:%v\t", f.Depth+1, vstats.AC, vhealth.HP, vstats.Str)
+	if viewer.Dead() {
+		stats = "You die... Press any key."
+	}
 	for i, c := range stats {
 		tbox.SetCell(i, statOffset, c, termbox.ColorWhite, termbox.ColorBlack)
 	}
 
 }
 
-// Cardinal direction movement with basic collision detection.
+// animationFrame counts -animate intervals, so animated tiles change once
+// an interval. It's always 0 with animation off.
+func animationFrame() int {
+	if *animateEvery <= 0 {
+		return 0
+	}
+	return int(time.Now().UnixNano() / int64(*animateEvery))
+}
+
+// Movement's options.
+const (
+	MoveUp = iota + 1
+	MoveDown
+	MoveLeft
+	MoveRight
+	MoveWait
+	MoveUpLeft
+	MoveUpRight
+	MoveDownLeft
+	MoveDownRight
+)
+
+// Eight direction movement with basic collision detection. Moving into
+// another entity attacks it.
 func Movement(e *Entity) func(int) {
 	return func(i int) {
-		x := e.GetAttribute("xpos")
-		y := e.GetAttribute("ypos")
+		pos, ok := e.Position()
+		if !ok {
+			return
+		}
+		x, y := pos.X, pos.Y
 		switch i {
-		case 1:
+		case MoveUp:
 			y -= 1
-		case 2:
+		case MoveDown:
 			y += 1
-		case 3:
+		case MoveLeft:
 			x -= 1
-		case 4:
+		case MoveRight:
 			x += 1
-		case 5:
+		case MoveUpLeft:
+			x, y = x-1, y-1
+		case MoveUpRight:
+			x, y = x+1, y-1
+		case MoveDownLeft:
+			x, y = x-1, y+1
+		case MoveDownRight:
+			x, y = x+1, y+1
+		default:
+			return
+		}
+		l := e.Level()
+		if l == nil {
 			return
 		}
-		tile, ok := level.GetTile(x, y)
+		tile, ok := l.TileAt(x, y)
 		if !ok {
 			return
 		}
-		if tile != '.' {
+		if !tile.Passable(e) {
 			return
 		}
-		others := level.GetEntity(x, y)
+		others := l.GetEntity(x, y)
 		if others != nil {
-			GlobalMessages.Broadcast(fmt.Sprintf("%v bumped %v.", string(e.Symbol), string(others[0].Symbol)))
+			Attack(e, others[0])
 			return // Don't move entity to occupied tile.
 		}
-		e.SetAttribute("xpos", x)
-		e.SetAttribute("ypos", y)
+		l.MoveEntity(e, x, y)
 	}
 }
 
+// makeEntity makes a creature: an entity with every component, standing at
+// x, y. It has no AI until StartAI.
 func makeEntity(x, y int, symbol rune) *Entity {
+	e := newEntity()
+	e.SetPosition(Position{x, y})
+	e.SetHealth(Health{HP: 10, MaxHP: 10})
+	e.SetStats(Stats{AC: 10, Str: 5, Sight: defaultSight, Speed: defaultSpeed})
+	e.SetRenderable(Renderable{symbol, termbox.ColorWhite})
+	e.inventory = &Inventory{}
+	return e
+}
+
+// newEntity makes an entity with no components, ready for them to be
+// attached.
+func newEntity() *Entity {
 	e := &Entity{}
-	e.Symbol = symbol
-	e.Attributes = map[string]int{}
 	e.Predicates = map[string]Predicate{}
-	e.SetAttribute("xpos", x)
-	e.SetAttribute("ypos", y)
-	e.SetAttribute("HP", 10)
-	e.SetAttribute("AC", 10)
-	e.SetAttribute("Str", 5)
 
-	e.Predicates["Movement"] = Predicate{4, Movement(e)}
-	e.Tock = make(chan bool)
+	e.Predicates["Movement"] = Predicate{MoveDownRight, Movement(e)}
+	e.Predicates["PickUp"] = Predicate{maxInventory, PickUp(e)}
+	e.Predicates["Drop"] = Predicate{maxInventory, Drop(e)}
+	e.Predicates["Quaff"] = Predicate{maxInventory, Quaff(e)}
+	e.Predicates["Wield"] = Predicate{maxInventory, Wield(e)}
+	e.Predicates["Climb"] = Predicate{ClimbDown, Climb(e)}
+	e.Tock = make(chan int)
+	e.turnDone = make(chan struct{}, 1)
+	e.stop = make(chan struct{})
+	// No AI yet, so the scheduler shouldn't wait on one.
+	e.aiExited = make(chan struct{})
+	close(e.aiExited)
 
 	return e
 }
 
-// Takes an entity, moves it around randomly every tick
-func RandomAI(e *Entity) {
-	for {
-		<-e.Tock
-		m, _ := e.Predicates["Movement"]
-		// Roll 1d4, pick movement direction.
-		m.Pick(roll(1, 5))
-	}
-}
+var seed = flag.Int64("seed", 0, "seed for the game's random numbers; 0 picks one from the clock")
+var listenAddr = flag.String("listen", "", "serve the game over TCP on this address (e.g. :4000) instead of the local terminal")
+var savePath = flag.String("save", "shogun.sav", "file the save key writes the game to")
+var loadPath = flag.String("load", "", "resume the game saved in this file")
 
-// Ignores ticks, does whatever.
-func IgnoreAI(e *Entity) {
-	for {
-		<-e.Tock
+// newGame sets up a fresh level from the -map flag, or the -generate flag
+// if it's set.
+func newGame() error {
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	GlobalRNG = NewRNG(*seed)
+	var mf *MapFile
+	var err error
+	if *generator != "" {
+		var width, height int
+		if width, height, err = generatedSize(); err == nil {
+			mf, err = GenerateMapFile(*generator, width, height, *seed, StairsDown)
+		}
+	} else {
+		mf, err = LoadMapFile(MapPath(*mapName))
 	}
-}
-
-// Load map from file.
-// TODO(max): currently load static assets from src file based on $GOPATH.
-// This is naive. Should pass a flag.
-func LoadMapFromFile() [][]byte {
-	var ret [][]byte
-
-	goPath := os.Getenv("GOPATH")
-	file, err := os.Open(goPath + "/src/shogun/temp.des.txt")
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		r := []byte(scanner.Text())
-		ret = append(ret, r)
+	l, err := mf.NewLevel()
+	if err != nil {
+		return err
 	}
-
-	if err := scanner.Err(); err != nil {
-		panic(err)
+	if world != nil {
+		world.Unload()
 	}
+	world = NewWorld(l, *seed)
 
-	return ret
+	GlobalMessages = NewMessages()
+	GlobalMessages.Broadcast("First Message")
+	GlobalMessages.Broadcast("Welcome to game start.")
+	GlobalMessages.Broadcast("Third message.")
+	GlobalMessages.Broadcast(fmt.Sprintf("Random seed is %v.", GlobalRNG.Seed()))
+	return nil
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		os.Exit(replayMain(os.Args[2:]))
+	}
+	flag.Parse()
+
 	// Start Engine
-	board := LoadMapFromFile()
-	level = &Level{board, nil}
+	err := LoadItemDefs(*itemsPath)
+	if err == nil {
+		err = LoadKeyMap(KeyMapPath(*keysName))
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+		os.Exit(1)
+	}
+	if *loadPath != "" {
+		err = LoadGame(*loadPath)
+	} else {
+		err = newGame()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+		os.Exit(1)
+	}
 
-	// Create Entities; give them behaviors.
-	Player = makeEntity(24, 10, '@')
-	go IgnoreAI(Player)
-	level.RegisterEntity(Player)
-	level.Entities = append(level.Entities, Player)
+	gameLoop = NewGameLoop()
+	go gameLoop.Run()
+	defer gameLoop.Stop()
 
-	monster1 := makeEntity(5, 5, 'm')
-	go RandomAI(monster1)
-	level.RegisterEntity(monster1)
+	if *listenAddr != "" {
+		// Saved players have nobody to drive them until they reconnect.
+		gameLoop.Do(func() {
+			for _, e := range world.Players() {
+				e.Level().RemoveEntity(e)
+			}
+		})
 
-	GlobalMessages = &Messages{[]string{"First Message"}, 0}
-	GlobalMessages.Broadcast("Welcome to game start.")
-	GlobalMessages.Broadcast("Third message.")
+		if *accountsPath != "" {
+			if accounts, err = LoadAccounts(*accountsPath); err != nil {
+				fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+				os.Exit(1)
+			}
+		}
+		if err := Serve(*listenAddr); err != nil {
+			fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// Pick up the saved player, or create the local player and give it a
+	// behavior.
+	var player *Entity
+	if players := world.Players(); len(players) > 0 {
+		player = players[0]
+	}
+	if player == nil {
+		if player = joinPlayer(nil); player == nil {
+			fmt.Fprintf(os.Stderr, "shogun: nowhere to put the player\n")
+			os.Exit(1)
+		}
+	}
 
 	// Animation Setup
-	tbox = termbox.NewClient()
-	err := tbox.Init()
+	tbox := termbox.NewClient()
+	err = tbox.Init()
 	if err != nil {
 		fmt.Printf("Panicing\n")
 		panic(err)
 	}
 	tbox.Out = os.Stdout
 	tbox.In = os.Stdin
+	width, height := tbox.Size()
+	rec, err := recordSession(os.Stdout, width, height, "local")
+	if err != nil {
+		tbox.Close()
+		fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+		os.Exit(1)
+	}
+	if rec != nil {
+		tbox.Out = rec
+		defer rec.Close()
+	}
 	defer tbox.Close()
-	tbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
-
-	// Animation Loop
-	go func() {
-		tbox.SetOutputMode(termbox.Output256)
-		for {
-			time.Sleep(10 * time.Millisecond) // Not necessary, replace with tick mechanic
-			tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
-			drawGame(level)
-			tbox.Flush()
-		}
-	}()
 
-	// Player Input Loop
-	m, _ := Player.Predicates["Movement"]
-loop:
-	for {
-		switch ev := tbox.PollEvent(); ev.Type {
-		case termbox.EventKey:
-			level.Tick()
-			GlobalMessages.Broadcast("Tick.")
-			if ev.Key == termbox.KeyCtrlC {
-				break loop
-			}
-			if ev.Ch == rune('a') {
-				m.Pick(1)
-			}
-			if ev.Key == termbox.KeyArrowUp {
-				m.Pick(1)
-			}
-			if ev.Key == termbox.KeyArrowDown {
-				m.Pick(2)
-			}
-			if ev.Key == termbox.KeyArrowLeft {
-				m.Pick(3)
-			}
-			if ev.Key == termbox.KeyArrowRight {
-				m.Pick(4)
-			}
-			if ev.Ch == rune('.') {
-				m.Pick(5)
-			}
-		}
-	}
+	session := &Session{Client: tbox, Player: player, Recorder: rec}
+	session.Run()
 }
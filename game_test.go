@@ -0,0 +1,41 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+	"testing"
+	"time"
+)
+
+// What drawGame shows the player on the AI test map, with a rat in sight, a
+// kobold behind the wall and gold on the floor.
+const drawGameGolden = `Welcome.
+
+
+
+
+##########
+#@...$..r#
+#.####   #
+#..
+###
+Dlvl:1  AC: 10  HP:10  Str:5
+`
+
+func TestDrawGame(t *testing.T) {
+	defer func(d time.Duration) { *animateEvery = d }(*animateEvery)
+	*animateEvery = 0
+	level, player := aiTestLevel(t, 1, 1)
+	defer level.Unload()
+	level.RegisterEntity(makeEntity(8, 1, 'r'))
+	level.RegisterEntity(makeEntity(3, 3, 'k'))
+	level.AddItem(5, 1, &Item{&ItemDef{Name: "gold piece", Symbol: '$', Kind: KindGold}, 3})
+	GlobalMessages.Broadcast("Welcome.")
+
+	tbox := termbox.NewVirtualClient(30, 12)
+	defer tbox.Close()
+	drawGame(tbox, snapshot(level, 0, GlobalMessages.All()), player)
+	tbox.Flush()
+	if got := tbox.Snapshot().String(); got != drawGameGolden {
+		t.Errorf("drew\n%v\nwant\n%v", got, drawGameGolden)
+	}
+}
@@ -0,0 +1,107 @@
+package generate
+
+import (
+	"math/rand"
+)
+
+// Smallest area BSP splits, and the smallest room it puts in one.
+const (
+	minLeaf = 8
+	minRoom = 3
+)
+
+type rect struct {
+	x, y, w, h int
+}
+
+func (r rect) center() (int, int) {
+	return r.x + r.w/2, r.y + r.h/2
+}
+
+// BSP draws rooms joined by corridors, in walls. It splits the map in two
+// again and again, at random, until the pieces are small; puts a room in
+// each piece; then joins the two halves of every split with a corridor.
+func BSP(width, height int, r *rand.Rand) [][]byte {
+	m := filled(width, height, Wall)
+	bspSplit(m, rect{1, 1, width - 2, height - 2}, r)
+	connect(m, Floor)
+	return m
+}
+
+// bspSplit fills area with rooms and returns one of them, for the caller
+// to run a corridor to.
+func bspSplit(m [][]byte, area rect, r *rand.Rand) rect {
+	canW, canH := area.w >= 2*minLeaf, area.h >= 2*minLeaf
+	// Split across the longer side, so pieces stay roughly square.
+	vertical := canW && (!canH || area.w > area.h || area.w == area.h && r.Intn(2) == 0)
+	if !canW && !canH || area.w*area.h < 4*minLeaf*minLeaf && r.Intn(3) == 0 {
+		return bspRoom(m, area, r)
+	}
+	var a, b rect
+	if vertical {
+		cut := between(r, minLeaf, area.w-minLeaf)
+		a = rect{area.x, area.y, cut, area.h}
+		b = rect{area.x + cut, area.y, area.w - cut, area.h}
+	} else {
+		cut := between(r, minLeaf, area.h-minLeaf)
+		a = rect{area.x, area.y, area.w, cut}
+		b = rect{area.x, area.y + cut, area.w, area.h - cut}
+	}
+	roomA, roomB := bspSplit(m, a, r), bspSplit(m, b, r)
+	ax, ay := roomA.center()
+	bx, by := roomB.center()
+	corridor(m, ax, ay, bx, by, r)
+	if r.Intn(2) == 0 {
+		return roomA
+	}
+	return roomB
+}
+
+// bspRoom digs a random room inside area, leaving a wall between it and
+// the area's edge.
+func bspRoom(m [][]byte, area rect, r *rand.Rand) rect {
+	w := between(r, minRoom, area.w-2)
+	h := between(r, minRoom, area.h-2)
+	room := rect{
+		x: area.x + between(r, 1, area.w-w-1),
+		y: area.y + between(r, 1, area.h-h-1),
+		w: w,
+		h: h,
+	}
+	for y := room.y; y < room.y+room.h; y++ {
+		for x := room.x; x < room.x+room.w; x++ {
+			m[y][x] = Floor
+		}
+	}
+	return room
+}
+
+// corridor digs an L-shaped corridor between two points, turning the
+// corner one way or the other at random.
+func corridor(m [][]byte, x1, y1, x2, y2 int, r *rand.Rand) {
+	if r.Intn(2) == 0 {
+		hline(m, x1, x2, y1)
+		vline(m, y1, y2, x2)
+	} else {
+		vline(m, y1, y2, x1)
+		hline(m, x1, x2, y2)
+	}
+}
+
+func hline(m [][]byte, x1, x2, y int) {
+	if x1 > x2 {
+		x1, x2 = x2, x1
+	}
+	for x := x1; x <= x2; x++ {
+		m[y][x] = Floor
+	}
+}
+
+func vline(m [][]byte, y1, y2, x int) {
+	if y1 > y2 {
+		y1, y2 = y2, y1
+	}
+	for y := y1; y <= y2; y++ {
+		m[y][x] = Floor
+	}
+}
@@ -0,0 +1,64 @@
+package generate
+
+import (
+	"math/rand"
+)
+
+// Cave generation: the share of tiles that start as wall, how many times
+// the map is smoothed, and the smallest pocket of cave kept rather than
+// filled in.
+const (
+	caveFill    = 45
+	caveSmooth  = 5
+	minCaveArea = 20
+)
+
+// Caves draws winding caverns by cellular automaton: it scatters walls at
+// random, then repeatedly turns each tile to wall if most of its
+// neighbours are wall and to floor if few are. Pockets too small to
+// matter are filled in and the rest tunnelled together.
+func Caves(width, height int, r *rand.Rand) [][]byte {
+	m := filled(width, height, Wall)
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			if r.Intn(100) >= caveFill {
+				m[y][x] = Floor
+			}
+		}
+	}
+	for i := 0; i < caveSmooth; i++ {
+		m = smooth(m, Wall, Floor)
+	}
+	removeSmall(m, minCaveArea, Wall)
+	connect(m, Floor)
+	return m
+}
+
+// smooth runs one step of the automaton: a tile becomes solid if five or
+// more of the nine tiles around and including it are, and open if fewer
+// than four are. The edge stays solid.
+func smooth(m [][]byte, solid, open byte) [][]byte {
+	width, height := len(m[0]), len(m)
+	next := filled(width, height, solid)
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			n := 0
+			for dy := -1; dy <= 1; dy++ {
+				for dx := -1; dx <= 1; dx++ {
+					if m[y+dy][x+dx] == solid {
+						n++
+					}
+				}
+			}
+			switch {
+			case n >= 5:
+				next[y][x] = solid
+			case n < 4:
+				next[y][x] = open
+			default:
+				next[y][x] = m[y][x]
+			}
+		}
+	}
+	return next
+}
@@ -0,0 +1,211 @@
+// Package generate makes random levels, as rows of tile glyphs ready for
+// Level.Game. Every generator is seeded, so a seed always gives the same
+// map, and every map it makes is fully connected: a walker can get from
+// any walkable tile to any other.
+package generate
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+)
+
+// The tile glyphs generators draw with; see the tiles registered in the
+// game.
+const (
+	Floor = '.'
+	Wall  = '#'
+	Water = '~'
+	Shore = '/'
+)
+
+// Smallest map a generator will make.
+const (
+	MinWidth  = 20
+	MinHeight = 10
+)
+
+// A Generator draws a width by height map using r for its randomness.
+type Generator func(width, height int, r *rand.Rand) [][]byte
+
+// Generators are the known generators by name.
+var Generators = map[string]Generator{
+	"bsp":     BSP,
+	"caves":   Caves,
+	"islands": Islands,
+}
+
+// Names returns the generators' names, sorted.
+func Names() []string {
+	var names []string
+	for name := range Generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Generate makes a width by height map with the named generator.
+func Generate(name string, width, height int, seed int64) ([][]byte, error) {
+	g, ok := Generators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q, want one of %v", name, Names())
+	}
+	if width < MinWidth || height < MinHeight {
+		return nil, fmt.Errorf("map %vx%v is too small, want at least %vx%v", width, height, MinWidth, MinHeight)
+	}
+	return g(width, height, rand.New(rand.NewSource(seed))), nil
+}
+
+// Walkable reports whether anyone can stand on a glyph.
+func Walkable(c byte) bool {
+	return c == Floor || c == Shore
+}
+
+// Connected reports whether every walkable tile of m can be reached from
+// every other, and there is at least one.
+func Connected(m [][]byte) bool {
+	regions, _ := label(m)
+	return regions == 1
+}
+
+// filled returns a width by height map of glyph c.
+func filled(width, height int, c byte) [][]byte {
+	m := make([][]byte, height)
+	for y := range m {
+		m[y] = make([]byte, width)
+		for x := range m[y] {
+			m[y][x] = c
+		}
+	}
+	return m
+}
+
+// border reports whether x, y is on the edge of m.
+func border(m [][]byte, x, y int) bool {
+	return x == 0 || y == 0 || y == len(m)-1 || x == len(m[0])-1
+}
+
+var steps = [4][2]int{{0, -1}, {0, 1}, {-1, 0}, {1, 0}}
+
+// label numbers m's walkable regions from 1 by flood fill, returning how
+// many there are and each tile's region, 0 for unwalkable.
+func label(m [][]byte) (int, [][]int) {
+	width, height := len(m[0]), len(m)
+	ids := make([][]int, height)
+	for y := range ids {
+		ids[y] = make([]int, width)
+	}
+	n := 0
+	for y := range m {
+		for x := range m[y] {
+			if !Walkable(m[y][x]) || ids[y][x] != 0 {
+				continue
+			}
+			n++
+			ids[y][x] = n
+			queue := [][2]int{{x, y}}
+			for len(queue) > 0 {
+				p := queue[0]
+				queue = queue[1:]
+				for _, s := range steps {
+					nx, ny := p[0]+s[0], p[1]+s[1]
+					if nx < 0 || ny < 0 || nx >= width || ny >= height {
+						continue
+					}
+					if Walkable(m[ny][nx]) && ids[ny][nx] == 0 {
+						ids[ny][nx] = n
+						queue = append(queue, [2]int{nx, ny})
+					}
+				}
+			}
+		}
+	}
+	return n, ids
+}
+
+// removeSmall fills walkable regions of fewer than min tiles with glyph c.
+func removeSmall(m [][]byte, min int, c byte) {
+	n, ids := label(m)
+	sizes := make([]int, n+1)
+	for y := range ids {
+		for x := range ids[y] {
+			sizes[ids[y][x]]++
+		}
+	}
+	for y := range ids {
+		for x, id := range ids[y] {
+			if id != 0 && sizes[id] < min {
+				m[y][x] = c
+			}
+		}
+	}
+}
+
+// connect joins m's walkable regions into one, tunnelling from the region
+// holding the first walkable tile to the nearest other region, and
+// repeating until there's only one. Tunnels are drawn with glyph c, and
+// never touch the edge of the map. A map with nothing walkable gets a
+// floor in the middle.
+func connect(m [][]byte, c byte) {
+	width, height := len(m[0]), len(m)
+	for {
+		n, ids := label(m)
+		if n == 0 {
+			m[height/2][width/2] = c
+			continue
+		}
+		if n == 1 {
+			return
+		}
+		// Breadth first search out of region 1 through anything but the
+		// border, stopping at the first tile of another region.
+		from := make([][][2]int, height)
+		seen := make([][]bool, height)
+		for y := range from {
+			from[y] = make([][2]int, width)
+			seen[y] = make([]bool, width)
+		}
+		var queue [][2]int
+		for y := range ids {
+			for x, id := range ids[y] {
+				if id == 1 {
+					seen[y][x] = true
+					queue = append(queue, [2]int{x, y})
+				}
+			}
+		}
+		var found *[2]int
+		for len(queue) > 0 && found == nil {
+			p := queue[0]
+			queue = queue[1:]
+			for _, s := range steps {
+				nx, ny := p[0]+s[0], p[1]+s[1]
+				if border(m, nx, ny) || seen[ny][nx] {
+					continue
+				}
+				seen[ny][nx] = true
+				from[ny][nx] = p
+				if ids[ny][nx] > 1 {
+					found = &[2]int{nx, ny}
+					break
+				}
+				queue = append(queue, [2]int{nx, ny})
+			}
+		}
+		if found == nil {
+			panic(fmt.Errorf("Couldn't connect regions of a %vx%v map", width, height))
+		}
+		for p := from[found[1]][found[0]]; ids[p[1]][p[0]] != 1; p = from[p[1]][p[0]] {
+			m[p[1]][p[0]] = c
+		}
+	}
+}
+
+// between returns a random int in [lo, hi].
+func between(r *rand.Rand, lo, hi int) int {
+	if hi <= lo {
+		return lo
+	}
+	return lo + r.Intn(hi-lo+1)
+}
@@ -0,0 +1,55 @@
+package generate
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenerate_Connected(t *testing.T) {
+	for _, name := range Names() {
+		for seed := int64(1); seed <= 20; seed++ {
+			for _, size := range [][2]int{{MinWidth, MinHeight}, {80, 24}, {150, 40}} {
+				m, err := Generate(name, size[0], size[1], seed)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(m) != size[1] || len(m[0]) != size[0] {
+					t.Fatalf("%v made a %vx%v map, want %vx%v", name, len(m[0]), len(m), size[0], size[1])
+				}
+				if !Connected(m) {
+					t.Errorf("%v seed %v %vx%v isn't connected:\n%s", name, seed, size[0], size[1], bytes.Join(m, []byte("\n")))
+				}
+				for y := range m {
+					for x := range m[y] {
+						if border(m, x, y) && Walkable(m[y][x]) {
+							t.Fatalf("%v seed %v: walkable edge at %v,%v", name, seed, x, y)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestGenerate_Seeded(t *testing.T) {
+	for _, name := range Names() {
+		a, _ := Generate(name, 80, 24, 7)
+		b, _ := Generate(name, 80, 24, 7)
+		c, _ := Generate(name, 80, 24, 8)
+		if !bytes.Equal(bytes.Join(a, nil), bytes.Join(b, nil)) {
+			t.Errorf("%v made different maps from the same seed", name)
+		}
+		if bytes.Equal(bytes.Join(a, nil), bytes.Join(c, nil)) {
+			t.Errorf("%v made the same map from different seeds", name)
+		}
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	if _, err := Generate("mazes", 80, 24, 1); err == nil {
+		t.Errorf("unknown generator made a map")
+	}
+	if _, err := Generate("bsp", 5, 5, 1); err == nil {
+		t.Errorf("generator made a 5x5 map")
+	}
+}
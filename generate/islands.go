@@ -0,0 +1,48 @@
+package generate
+
+import (
+	"math/rand"
+)
+
+// Island generation: the share of tiles that start as land, how many times
+// the coast is smoothed, and the smallest island kept rather than sunk.
+const (
+	landFill      = 53
+	landSmooth    = 4
+	minIslandArea = 12
+)
+
+// Islands draws land in open sea, like the harbor: islands with sandy
+// shores, joined by sandbars so they're all reachable on foot. The land is
+// made the same way as Caves, with water for walls.
+func Islands(width, height int, r *rand.Rand) [][]byte {
+	m := filled(width, height, Water)
+	for y := 2; y < height-2; y++ {
+		for x := 2; x < width-2; x++ {
+			if r.Intn(100) < landFill {
+				m[y][x] = Floor
+			}
+		}
+	}
+	for i := 0; i < landSmooth; i++ {
+		m = smooth(m, Water, Floor)
+	}
+	removeSmall(m, minIslandArea, Water)
+	connect(m, Shore)
+
+	// Land touching the sea is shore.
+	for y := 1; y < height-1; y++ {
+		for x := 1; x < width-1; x++ {
+			if m[y][x] != Floor {
+				continue
+			}
+			for _, s := range steps {
+				if m[y+s[1]][x+s[0]] == Water {
+					m[y][x] = Shore
+					break
+				}
+			}
+		}
+	}
+	return m
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Inventory slots are lettered a to z.
+const maxInventory = 26
+
+// Kinds of item, which decide what can be done with them.
+const (
+	KindGold   = "gold"
+	KindWeapon = "weapon"
+	KindPotion = "potion"
+)
+
+var itemsPath = flag.String("items", dataPath(filepath.Join("data", "items.txt")), "file holding the item definitions")
+
+/*
+ *  ItemDef and Item structs.
+ */
+
+// ItemDef is one kind of item, as read from the item definitions file.
+type ItemDef struct {
+	Name   string
+	Symbol rune
+	Kind   string
+	// Damage done when wielded, for weapons.
+	Damage Dice
+	// HP restored when quaffed, for potions.
+	Heal Dice
+}
+
+// Stacks reports whether several of the item share one inventory slot.
+func (d *ItemDef) Stacks() bool {
+	return d.Kind != KindWeapon
+}
+
+// ItemDefs holds every known item definition, by name.
+var ItemDefs = map[string]*ItemDef{}
+
+// An Item is one or more of an ItemDef, lying on the map or carried.
+type Item struct {
+	Def   *ItemDef
+	Count int
+}
+
+func NewItem(name string, count int) (*Item, error) {
+	def, ok := ItemDefs[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown item %q", name)
+	}
+	return &Item{def, count}, nil
+}
+
+func (i *Item) String() string {
+	if i.Count == 1 {
+		return i.Def.Name
+	}
+	return fmt.Sprintf("%v %v", i.Count, plural(i.Def.Name))
+}
+
+// plural is good enough for our item names: "potions of healing",
+// "gold pieces".
+func plural(name string) string {
+	if i := strings.Index(name, " of "); i != -1 {
+		return name[:i] + "s" + name[i:]
+	}
+	return name + "s"
+}
+
+/*
+ *  Item definitions file.
+ */
+
+// The item definitions file has one item per line:
+//
+//	ITEM: "dagger", ')', weapon, damage 1d4+1
+//
+// giving the name, the symbol it's drawn with, its kind, and then any
+// properties as key and value: damage DICE for weapons, heal DICE for
+// potions.
+
+func LoadItemDefs(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	defs, err := ParseItemDefs(file)
+	if err != nil {
+		return fmt.Errorf("%v:%v", path, err)
+	}
+	ItemDefs = defs
+	return nil
+}
+
+func ParseItemDefs(r io.Reader) (map[string]*ItemDef, error) {
+	defs := map[string]*ItemDef{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	fail := func(format string, args ...interface{}) (map[string]*ItemDef, error) {
+		return nil, fmt.Errorf("%v: %v", lineNo, fmt.Sprintf(format, args...))
+	}
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if !strings.HasPrefix(line, "ITEM:") {
+			return fail("expected ITEM: line, got %q", line)
+		}
+		args := splitArgs(strings.TrimSpace(strings.TrimPrefix(line, "ITEM:")))
+		if len(args) < 3 {
+			return fail("ITEM wants \"name\", 'symbol', kind, got %v", line)
+		}
+		def := &ItemDef{}
+		name, err := strconv.Unquote(args[0])
+		if err != nil {
+			return fail("ITEM wants a quoted name, got %v", args[0])
+		}
+		if _, ok := defs[name]; ok {
+			return fail("item %q defined twice", name)
+		}
+		def.Name = name
+		if def.Symbol, err = parseGlyph(args[1]); err != nil {
+			return fail("bad ITEM symbol %v", args[1])
+		}
+		switch args[2] {
+		case KindGold, KindWeapon, KindPotion:
+			def.Kind = args[2]
+		default:
+			return fail("unknown item kind %q", args[2])
+		}
+		for _, prop := range args[3:] {
+			fields := strings.Fields(prop)
+			if len(fields) != 2 {
+				return fail("item property wants a key and value, got %q", prop)
+			}
+			d, err := ParseDice(fields[1])
+			if err != nil {
+				return fail("%v", err)
+			}
+			switch fields[0] {
+			case "damage":
+				def.Damage = d
+			case "heal":
+				def.Heal = d
+			default:
+				return fail("unknown item property %q", fields[0])
+			}
+		}
+		defs[name] = def
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return defs, nil
+}
+
+/*
+ *  Item predicates.
+ */
+
+// PickUp picks up the i'th item lying at the entity's feet.
+func PickUp(e *Entity) func(int) {
+	return func(i int) {
+		pos, ok := e.Position()
+		l := e.Level()
+		if !ok || l == nil {
+			return
+		}
+		item := l.TakeItem(pos.X, pos.Y, i)
+		if item == nil {
+			return
+		}
+		if !e.AddToInventory(item) {
+			l.AddItem(pos.X, pos.Y, item)
+			GlobalMessages.Send(e, "You can't carry any more.")
+			return
+		}
+		GlobalMessages.Broadcast(fmt.Sprintf("%v picks up %v.", e.Name(), item))
+	}
+}
+
+// Drop drops the entity's i'th inventory slot where it stands.
+func Drop(e *Entity) func(int) {
+	return func(i int) {
+		pos, ok := e.Position()
+		l := e.Level()
+		if !ok || l == nil {
+			return
+		}
+		item := e.RemoveFromInventory(i)
+		if item == nil {
+			return
+		}
+		l.AddItem(pos.X, pos.Y, item)
+		GlobalMessages.Broadcast(fmt.Sprintf("%v drops %v.", e.Name(), item))
+	}
+}
+
+// Quaff drinks one potion from the entity's i'th inventory slot.
+func Quaff(e *Entity) func(int) {
+	return func(i int) {
+		item := e.InventoryItem(i)
+		if item == nil || item.Def.Kind != KindPotion {
+			return
+		}
+		e.UseOne(i)
+		heal := item.Def.Heal.Roll(GlobalRNG)
+		e.UpdateHealth(func(h *Health) {
+			h.HP += heal
+			if h.HP > h.MaxHP {
+				h.HP = h.MaxHP
+			}
+		})
+		GlobalMessages.Broadcast(fmt.Sprintf("%v drinks a %v.", e.Name(), item.Def.Name))
+	}
+}
+
+// Wield makes the weapon in the entity's i'th inventory slot the one it
+// fights with. Wielding it again puts it away.
+func Wield(e *Entity) func(int) {
+	return func(i int) {
+		item := e.InventoryItem(i)
+		if item == nil || item.Def.Kind != KindWeapon {
+			return
+		}
+		e.mutex.Lock()
+		inv := e.inventory
+		if inv.Wielded == item {
+			inv.Wielded = nil
+		} else {
+			inv.Wielded = item
+		}
+		wielded := inv.Wielded
+		e.mutex.Unlock()
+		if wielded == nil {
+			GlobalMessages.Broadcast(fmt.Sprintf("%v puts away %v.", e.Name(), item))
+		} else {
+			GlobalMessages.Broadcast(fmt.Sprintf("%v wields %v.", e.Name(), item))
+		}
+	}
+}
+
+/*
+ *  Inventory methods on Entity.
+ */
+
+// AddToInventory adds item, merging it into a slot of the same kind if it
+// stacks. It reports false if every slot is taken, or the entity has no
+// Inventory.
+func (e *Entity) AddToInventory(item *Item) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	inv := e.inventory
+	if inv == nil {
+		return false
+	}
+	if item.Def.Stacks() {
+		for _, other := range inv.Items {
+			if other.Def == item.Def {
+				other.Count += item.Count
+				return true
+			}
+		}
+	}
+	if len(inv.Items) >= maxInventory {
+		return false
+	}
+	inv.Items = append(inv.Items, item)
+	return true
+}
+
+// RemoveFromInventory takes slot i out of the inventory, or returns nil if
+// there's no such slot.
+func (e *Entity) RemoveFromInventory(i int) *Item {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	inv := e.inventory
+	if inv == nil || i < 0 || i >= len(inv.Items) {
+		return nil
+	}
+	item := inv.Items[i]
+	inv.Items = append(inv.Items[:i], inv.Items[i+1:]...)
+	if inv.Wielded == item {
+		inv.Wielded = nil
+	}
+	return item
+}
+
+// UseOne uses up one item from slot i.
+func (e *Entity) UseOne(i int) {
+	e.mutex.Lock()
+	inv := e.inventory
+	if inv != nil && i >= 0 && i < len(inv.Items) && inv.Items[i].Count > 1 {
+		inv.Items[i].Count--
+		e.mutex.Unlock()
+		return
+	}
+	e.mutex.Unlock()
+	e.RemoveFromInventory(i)
+}
+
+// InventoryItem returns slot i, or nil if there's no such slot.
+func (e *Entity) InventoryItem(i int) *Item {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	inv := e.inventory
+	if inv == nil || i < 0 || i >= len(inv.Items) {
+		return nil
+	}
+	return inv.Items[i]
+}
+
+// InventoryList describes each inventory slot, for display.
+func (e *Entity) InventoryList() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.inventory == nil {
+		return nil
+	}
+	var ret []string
+	for i, item := range e.inventory.Items {
+		s := fmt.Sprintf("%c - %v", 'a'+i, item)
+		if item == e.inventory.Wielded {
+			s += " (wielded)"
+		}
+		ret = append(ret, s)
+	}
+	return ret
+}
+
+// WeaponDamage is the damage the entity does in melee: its wielded
+// weapon's, or its fists'.
+func (e *Entity) WeaponDamage() Dice {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	if e.inventory != nil && e.inventory.Wielded != nil {
+		return e.inventory.Wielded.Def.Damage
+	}
+	return fistDamage
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseItemDefs_Errors(t *testing.T) {
+	// Each file is broken in one way, and the error should say where.
+	for _, test := range []struct {
+		defs string
+		want string
+	}{
+		{"THING: \"rock\", '*', gold\n", "1: expected ITEM: line"},
+		{"ITEM: \"rock\", '*'\n", "1: ITEM wants"},
+		{"\nITEM: rock, '*', gold\n", "2: ITEM wants a quoted name"},
+		{"ITEM: \"rock\", **, gold\n", "1: bad ITEM symbol"},
+		{"ITEM: \"rock\", '*', stone\n", `1: unknown item kind "stone"`},
+		{"ITEM: \"rock\", '*', gold\nITEM: \"rock\", '*', gold\n", `2: item "rock" defined twice`},
+		{"ITEM: \"club\", ')', weapon, damage\n", "1: item property wants a key and value"},
+		{"ITEM: \"club\", ')', weapon, damage lots\n", `1: bad dice "lots"`},
+		{"ITEM: \"club\", ')', weapon, weight 3\n", `1: unknown item property "weight"`},
+	} {
+		defs, err := ParseItemDefs(strings.NewReader(test.defs))
+		if err == nil {
+			t.Errorf("ParseItemDefs(%q) = %v, want an error", test.defs, defs)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseItemDefs(%q): %v, want it to mention %q", test.defs, err, test.want)
+		}
+	}
+}
+
+// itemTestLevel loads the item definitions and sets up the AI test level,
+// with the player standing on (1,1).
+func itemTestLevel(t *testing.T) (*Level, *Entity) {
+	if err := LoadItemDefs(*itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	return aiTestLevel(t, 1, 1)
+}
+
+// newTestItem is NewItem for names known to be defined.
+func newTestItem(t *testing.T, name string, count int) *Item {
+	item, err := NewItem(name, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+func TestInventory_Stacks(t *testing.T) {
+	level, player := itemTestLevel(t)
+	defer level.Unload()
+	level.AddItem(1, 1, newTestItem(t, "gold piece", 3))
+	level.AddItem(1, 1, newTestItem(t, "gold piece", 4))
+	level.AddItem(1, 1, newTestItem(t, "dagger", 1))
+	level.AddItem(1, 1, newTestItem(t, "dagger", 1))
+	for i := 0; i < 4; i++ {
+		player.Perform(Decision{"PickUp", 0})
+	}
+	want := []string{"a - 7 gold pieces", "b - dagger", "c - dagger"}
+	if got := player.InventoryList(); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("inventory is %q, want %q", got, want)
+	}
+
+	// Dropping puts the whole stack down.
+	player.Perform(Decision{"Drop", 0})
+	if pile := level.ItemsAt(1, 1); len(pile) != 1 || pile[0].Count != 7 {
+		t.Errorf("dropped %v, want the 7 gold pieces", pile)
+	}
+}
+
+func TestInventory_Full(t *testing.T) {
+	level, player := itemTestLevel(t)
+	defer level.Unload()
+	for i := 0; i < maxInventory; i++ {
+		if !player.AddToInventory(newTestItem(t, "dagger", 1)) {
+			t.Fatalf("couldn't carry dagger %v", i+1)
+		}
+	}
+	level.AddItem(1, 1, newTestItem(t, "short sword", 1))
+	player.Perform(Decision{"PickUp", 0})
+	if pile := level.ItemsAt(1, 1); len(pile) != 1 || pile[0].Def.Name != "short sword" {
+		t.Errorf("left %v on the floor, want the short sword", pile)
+	}
+	if n := len(player.InventoryList()); n != maxInventory {
+		t.Errorf("carrying %v items, want %v", n, maxInventory)
+	}
+	// Stacking onto what's already carried needs no new slot.
+	player.RemoveFromInventory(0)
+	player.AddToInventory(newTestItem(t, "gold piece", 1))
+	if !player.AddToInventory(newTestItem(t, "gold piece", 2)) {
+		t.Errorf("couldn't add gold to a full inventory's gold")
+	}
+}
+
+func TestQuaff(t *testing.T) {
+	level, player := itemTestLevel(t)
+	defer level.Unload()
+	player.AddToInventory(newTestItem(t, "potion of extra healing", 2))
+
+	// Extra healing heals 4 to 16, so from 9 of 10 HP it always tops out.
+	player.SetHealth(Health{HP: 9, MaxHP: 10})
+	player.Perform(Decision{"Quaff", 0})
+	if h, _ := player.Health(); h.HP != h.MaxHP {
+		t.Errorf("quaffing left %v/%v HP, want it capped at %v", h.HP, h.MaxHP, h.MaxHP)
+	}
+	if item := player.InventoryItem(0); item == nil || item.Count != 1 {
+		t.Errorf("after one quaff slot a holds %v, want one potion", item)
+	}
+
+	// Using up the last of a stack empties its slot.
+	player.Perform(Decision{"Quaff", 0})
+	if item := player.InventoryItem(0); item != nil {
+		t.Errorf("after quaffing the last potion slot a holds %v", item)
+	}
+}
+
+func TestUseOne(t *testing.T) {
+	e := makeEntity(0, 0, 'e')
+	e.AddToInventory(&Item{&ItemDef{Name: "rock", Kind: KindGold}, 2})
+	e.AddToInventory(&Item{&ItemDef{Name: "pebble", Kind: KindGold}, 1})
+	e.UseOne(0)
+	e.UseOne(0)
+	if got := e.InventoryList(); len(got) != 1 || got[0] != "a - pebble" {
+		t.Errorf("inventory is %q after using both rocks, want just the pebble", got)
+	}
+	e.UseOne(0)
+	e.UseOne(5) // no such slot
+	if got := e.InventoryList(); len(got) != 0 {
+		t.Errorf("inventory is %q after using everything, want it empty", got)
+	}
+}
+
+func TestWield(t *testing.T) {
+	level, player := itemTestLevel(t)
+	defer level.Unload()
+	dagger := newTestItem(t, "dagger", 1)
+	player.AddToInventory(newTestItem(t, "potion of healing", 1))
+	player.AddToInventory(dagger)
+	target := makeEntity(2, 1, 't')
+	target.SetStats(Stats{AC: 1})
+	level.RegisterEntity(target)
+
+	// The range of damage 50 hits do, at Str 5 with no bonus.
+	damageRange := func() (min, max int) {
+		min = 1000
+		for i := 0; i < 50; i++ {
+			target.SetHealth(Health{HP: 100, MaxHP: 100})
+			Attack(player, target)
+			h, _ := target.Health()
+			d := 100 - h.HP
+			if d < min {
+				min = d
+			}
+			if d > max {
+				max = d
+			}
+		}
+		return min, max
+	}
+
+	if min, max := damageRange(); min != 1 || max != 4 {
+		t.Errorf("fists did %v to %v damage, want 1 to 4", min, max)
+	}
+	player.Perform(Decision{"Wield", 0}) // a potion, so nothing happens
+	player.Perform(Decision{"Wield", 1})
+	if got := player.WeaponDamage(); got != dagger.Def.Damage {
+		t.Errorf("wielding a dagger does %v damage, want %v", got, dagger.Def.Damage)
+	}
+	if min, max := damageRange(); min != 2 || max != 5 {
+		t.Errorf("a dagger did %v to %v damage, want 2 to 5", min, max)
+	}
+	// Wielding it again puts it away.
+	player.Perform(Decision{"Wield", 1})
+	if got := player.WeaponDamage(); got != fistDamage {
+		t.Errorf("after putting the dagger away damage is %v, want %v", got, fistDamage)
+	}
+}
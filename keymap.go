@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keymap files bind keys to commands, one per line:
+//
+//	# Comments and blank lines are ignored.
+//	KEY: 'h', left
+//	KEY: ArrowLeft, left
+//	KEY: Ctrl-P, history
+//
+// A key is either a quoted character or the name of a special key, see
+// keyNames. Commands are the moves in moveCommands, the inventory screens
+// in inventoryCommands, or one of otherCommands.
+
+var keysName = flag.String("keys", "vi", "key bindings: a profile in the keys directory (vi, numpad), or a path to a .keys file")
+
+// KeyMapPath resolves a -keys value as MapPath does a -map value.
+func KeyMapPath(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || filepath.Ext(name) == ".keys" {
+		return name
+	}
+	return filepath.Join(dataPath(filepath.Join("data", "keys")), name+".keys")
+}
+
+// moveCommands are the commands that take a Movement step.
+var moveCommands = map[string]int{
+	"up":         MoveUp,
+	"down":       MoveDown,
+	"left":       MoveLeft,
+	"right":      MoveRight,
+	"wait":       MoveWait,
+	"up-left":    MoveUpLeft,
+	"up-right":   MoveUpRight,
+	"down-left":  MoveDownLeft,
+	"down-right": MoveDownRight,
+}
+
+// otherCommands are the commands that aren't moves or inventory screens.
+var otherCommands = map[string]bool{
+	"pickup":  true,
+	"ascend":  true,
+	"descend": true,
+	"save":    true,
+	"history": true,
+	"quit":    true,
+}
+
+func isCommand(name string) bool {
+	_, move := moveCommands[name]
+	_, inventory := inventoryCommands[name]
+	return move || inventory || otherCommands[name]
+}
+
+// keyNames are the special keys a keymap can bind by name.
+var keyNames = map[string]termbox.Key{
+	"ArrowUp":    termbox.KeyArrowUp,
+	"ArrowDown":  termbox.KeyArrowDown,
+	"ArrowLeft":  termbox.KeyArrowLeft,
+	"ArrowRight": termbox.KeyArrowRight,
+	"Home":       termbox.KeyHome,
+	"End":        termbox.KeyEnd,
+	"PgUp":       termbox.KeyPgup,
+	"PgDn":       termbox.KeyPgdn,
+	"Insert":     termbox.KeyInsert,
+	"Delete":     termbox.KeyDelete,
+	"Enter":      termbox.KeyEnter,
+	"Esc":        termbox.KeyEsc,
+	"Tab":        termbox.KeyTab,
+	"Space":      termbox.KeySpace,
+	"Backspace":  termbox.KeyBackspace2,
+}
+
+func init() {
+	for i := 0; i < 12; i++ {
+		keyNames[fmt.Sprintf("F%v", i+1)] = termbox.KeyF1 - termbox.Key(i)
+	}
+	for c := 'A'; c <= 'Z'; c++ {
+		keyNames[fmt.Sprintf("Ctrl-%c", c)] = termbox.KeyCtrlA + termbox.Key(c-'A')
+	}
+}
+
+/*
+ *  KeyMap struct and methods.
+ */
+
+// A KeyMap binds keys to the names of commands.
+type KeyMap struct {
+	// Special keys, and keys that type a character.
+	Keys  map[termbox.Key]string
+	Chars map[rune]string
+}
+
+// Command returns the command ev is bound to, and ok if it's bound.
+func (k *KeyMap) Command(ev termbox.Event) (string, bool) {
+	var cmd string
+	if ev.Ch != 0 {
+		cmd = k.Chars[ev.Ch]
+	} else {
+		cmd = k.Keys[ev.Key]
+	}
+	return cmd, cmd != ""
+}
+
+// The keymap sessions use unless they're given their own, from the -keys
+// flag.
+var keyMap *KeyMap
+
+func LoadKeyMap(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	k, err := ParseKeyMap(file)
+	if err != nil {
+		return fmt.Errorf("%v:%v", path, err)
+	}
+	keyMap = k
+	return nil
+}
+
+// ParseKeyMap reads a keymap file. Errors are prefixed with the line
+// number they were found on.
+func ParseKeyMap(r io.Reader) (*KeyMap, error) {
+	k := &KeyMap{Keys: map[termbox.Key]string{}, Chars: map[rune]string{}}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	fail := func(format string, args ...interface{}) (*KeyMap, error) {
+		return nil, fmt.Errorf("%v: %v", lineNo, fmt.Sprintf(format, args...))
+	}
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if !strings.HasPrefix(line, "KEY:") {
+			return fail("expected KEY: line, got %q", line)
+		}
+		args := splitArgs(strings.TrimSpace(strings.TrimPrefix(line, "KEY:")))
+		if len(args) != 2 {
+			return fail("KEY wants a key and a command, got %v", line)
+		}
+		if !isCommand(args[1]) {
+			return fail("unknown command %q", args[1])
+		}
+		if strings.HasPrefix(args[0], "'") {
+			ch, err := parseGlyph(args[0])
+			if err != nil {
+				return fail("%v", err)
+			}
+			// Termbox reports the space bar as a key, not a character.
+			if ch != ' ' {
+				if _, ok := k.Chars[ch]; ok {
+					return fail("key %v bound twice", args[0])
+				}
+				k.Chars[ch] = args[1]
+				continue
+			}
+			args[0] = "Space"
+		}
+		key, ok := keyNames[args[0]]
+		if !ok {
+			return fail("unknown key %q", args[0])
+		}
+		if _, ok := k.Keys[key]; ok {
+			return fail("key %v bound twice", args[0])
+		}
+		k.Keys[key] = args[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+	"strings"
+	"testing"
+)
+
+func TestLoadKeyMap_Profiles(t *testing.T) {
+	for _, c := range []struct {
+		profile string
+		ev      termbox.Event
+		want    string
+	}{
+		{"vi", termbox.Event{Ch: 'y'}, "up-left"},
+		{"vi", termbox.Event{Ch: 'n'}, "down-right"},
+		{"vi", termbox.Event{Key: termbox.KeyArrowLeft}, "left"},
+		{"vi", termbox.Event{Key: termbox.KeyCtrlP}, "history"},
+		{"numpad", termbox.Event{Ch: '9'}, "up-right"},
+		{"numpad", termbox.Event{Key: termbox.KeyEnd}, "down-left"},
+	} {
+		if err := LoadKeyMap(KeyMapPath(c.profile)); err != nil {
+			t.Fatal(err)
+		}
+		if got, _ := keyMap.Command(c.ev); got != c.want {
+			t.Errorf("%v: %+v is bound to %q, want %q", c.profile, c.ev, got, c.want)
+		}
+	}
+}
+
+func TestParseKeyMap_Errors(t *testing.T) {
+	for _, src := range []string{
+		"KEY: 'h', leftwards",
+		"KEY: Ctrl-%, left",
+		"KEY: 'h', left\nKEY: 'h', right",
+		"BIND: 'h', left",
+	} {
+		if _, err := ParseKeyMap(strings.NewReader(src)); err == nil {
+			t.Errorf("%q parsed without error", src)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"strings"
+	"sync"
+)
+
+// Wrong passwords allowed before the connection is dropped.
+const maxLoginFailures = 3
+
+// The fields of the login screen, in the order they're filled in.
+const (
+	loginName = iota
+	loginPassword
+	loginConfirm
+)
+
+// loginLabels are the fields' labels, padded to line the fields up.
+var loginLabels = [...]string{"Name:     ", "Password: ", "Again:    "}
+
+// login asks tbox's user for their account name and password, registering
+// names that are new, and logs them in. It returns the name, or "" if they
+// left instead or got the password wrong too often.
+func login(tbox *termbox.TermClient, rec *Recorder) string {
+	tbox.SetInputMode(termbox.InputEsc)
+	tbox.SetOutputMode(termbox.Output256)
+
+	// What's been typed into each field, the field being typed into, and
+	// a line about how it's going.
+	var fields [len(loginLabels)]string
+	stage := loginName
+	registering := false
+	note := "Type your name, or a new one to register."
+	var mutex sync.Mutex
+
+	draw := func() {
+		top := gameLoop.Top()
+		if top == nil {
+			return
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+		drawString(tbox, 0, 0, fmt.Sprintf("Welcome to %v.", top.Name), termbox.ColorYellow)
+		for i := loginName; i <= stage; i++ {
+			text := fields[i]
+			if i != loginName {
+				text = strings.Repeat("*", len([]rune(text)))
+			}
+			drawString(tbox, 0, 2+i, loginLabels[i]+text, termbox.ColorWhite)
+			if i == stage {
+				tbox.SetCursor(len(loginLabels[i])+len([]rune(text)), 2+i)
+			}
+		}
+		drawString(tbox, 0, 6, note, termbox.ColorWhite)
+		drawString(tbox, 0, 8, "Enter goes on, Esc leaves.", rememberedColor)
+	}
+	redraw := make(chan struct{}, 1)
+	// The caller closes the client once we return, so make sure nothing is
+	// still drawing into it.
+	defer tbox.HideCursor()
+	defer drawLoop(tbox, 0, rec, redraw, draw)()
+
+	failures := 0
+	for {
+		ev := tbox.PollEvent()
+		if ev.Type == termbox.EventError {
+			return ""
+		}
+		if ev.Type != termbox.EventKey {
+			continue
+		}
+		mutex.Lock()
+		field := &fields[stage]
+		switch {
+		case ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlC:
+			mutex.Unlock()
+			return ""
+		case ev.Key == termbox.KeyBackspace, ev.Key == termbox.KeyBackspace2:
+			if r := []rune(*field); len(r) > 0 {
+				*field = string(r[:len(r)-1])
+			}
+		case ev.Ch != 0 && len(*field) < 64:
+			*field += string(ev.Ch)
+		// Termbox reports the space bar as a key, not a character.
+		case ev.Key == termbox.KeySpace && len(*field) < 64:
+			*field += " "
+		case ev.Key == termbox.KeyEnter:
+			name, password := fields[loginName], fields[loginPassword]
+			switch stage {
+			case loginName:
+				if err := checkName(name); err != nil {
+					note = fmt.Sprintf("Sorry, %v.", err)
+					break
+				}
+				registering = !accounts.Exists(name)
+				stage = loginPassword
+				note = "Type your password."
+				if registering {
+					note = fmt.Sprintf("%v is a new account: choose a password.", name)
+				}
+			case loginPassword:
+				if registering {
+					if len(password) < minPasswordLength {
+						note = fmt.Sprintf("Sorry, passwords are at least %v letters long.", minPasswordLength)
+						break
+					}
+					stage = loginConfirm
+					note = "Type it again, to be sure."
+					break
+				}
+				err := accounts.Login(name, password)
+				if err == nil {
+					mutex.Unlock()
+					return name
+				}
+				if failures++; failures >= maxLoginFailures {
+					mutex.Unlock()
+					return ""
+				}
+				note = fmt.Sprintf("Sorry, %v.", err)
+				fields[loginPassword] = ""
+			case loginConfirm:
+				if fields[loginConfirm] != password {
+					note = "They didn't match; choose a password again."
+					fields[loginPassword], fields[loginConfirm] = "", ""
+					stage = loginPassword
+					break
+				}
+				err := accounts.Register(name, password)
+				if err == nil {
+					mutex.Unlock()
+					return name
+				}
+				// Somebody else took the name in the meantime.
+				note = fmt.Sprintf("Sorry, %v.", err)
+				fields = [len(loginLabels)]string{}
+				stage = loginName
+			}
+		}
+		mutex.Unlock()
+		select {
+		case redraw <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"sync"
+)
+
+// How many actions can wait for the game loop before senders block.
+const actionQueue = 64
+
+/*
+ *  GameLoop struct and methods.
+ */
+
+// An Action is a change to the game, run on the game loop's goroutine.
+type Action func()
+
+type queuedAction struct {
+	do   Action
+	done chan struct{}
+}
+
+// The GameLoop is the one goroutine allowed to change the game. Sessions
+// send it Actions, and after each one it publishes a Frame of every level:
+// a snapshot that renderers draw from without touching the live state. AIs
+// still run in their own goroutines, but only while the loop is waiting on
+// them in Level.Tick.
+type GameLoop struct {
+	actions chan queuedAction
+	quit    chan struct{}
+	stop    sync.Once
+
+	// The latest frame of each level, and a channel closed when they're
+	// replaced.
+	frames  map[*Level]*Frame
+	top     *Frame
+	changed chan struct{}
+	mutex   sync.Mutex
+}
+
+func NewGameLoop() *GameLoop {
+	return &GameLoop{
+		actions: make(chan queuedAction, actionQueue),
+		quit:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// Run processes actions until Stop is called.
+func (g *GameLoop) Run() {
+	g.publish()
+	for {
+		select {
+		case a := <-g.actions:
+			a.do()
+			g.publish()
+			close(a.done)
+		case <-g.quit:
+			return
+		}
+	}
+}
+
+func (g *GameLoop) Stop() {
+	g.stop.Do(func() { close(g.quit) })
+}
+
+// Do queues a for the loop and waits until it has run and its results are
+// published. Once the loop has stopped, Do drops a and returns at once.
+func (g *GameLoop) Do(a Action) {
+	qa := queuedAction{a, make(chan struct{})}
+	select {
+	case g.actions <- qa:
+	case <-g.quit:
+		return
+	}
+	select {
+	case <-qa.done:
+	case <-g.quit:
+	}
+}
+
+// Frame returns the latest frame of l, and a channel that's closed once
+// there's a newer one. The frame is nil if l was built since the last
+// publish, as when an action takes a player down to a new level.
+func (g *GameLoop) Frame(l *Level) (*Frame, <-chan struct{}) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.frames[l], g.changed
+}
+
+// Top returns the latest frame of the top level, or nil before the first
+// publish. Screens that aren't about any one player read the world from it.
+func (g *GameLoop) Top() *Frame {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.top
+}
+
+// Changed returns a channel that's closed once there are newer frames.
+func (g *GameLoop) Changed() <-chan struct{} {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.changed
+}
+
+func (g *GameLoop) publish() {
+	frames := map[*Level]*Frame{}
+	messages := GlobalMessages.All()
+	for _, l := range world.Levels {
+		frames[l] = snapshot(l, world.Turn, messages)
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.frames = frames
+	g.top = frames[world.Top()]
+	close(g.changed)
+	g.changed = make(chan struct{})
+}
+
+// The game loop every session sends its actions to.
+var gameLoop *GameLoop
+
+/*
+ *  Frame struct and methods.
+ */
+
+// A Frame is the state of a level at one moment, for drawing. Nothing in it
+// changes once it's published; frames of different levels published
+// together share their Messages.
+type Frame struct {
+	Turn  int
+	Depth int
+	// The level's Name.
+	Name string
+	// The level, for its terrain only: Level.Game never changes once a
+	// level is built, so frames share it rather than copying it. Nothing
+	// else in Level may be read from a frame.
+	Level    *Level
+	Entities map[*Entity]EntityView
+	// The symbol of the top item of each pile.
+	Items    map[Point]rune
+	Messages []Message
+	index    *SpatialIndex
+}
+
+// EntityView is an entity's components as they were when the frame was
+// taken.
+type EntityView struct {
+	Entity     *Entity
+	Components ComponentSet
+	Position   Position
+	Health     Health
+	Stats      Stats
+	Renderable Renderable
+	// As InventoryList.
+	Inventory []string
+}
+
+func snapshot(l *Level, turn int, messages []Message) *Frame {
+	f := &Frame{
+		Turn:     turn,
+		Depth:    l.Depth,
+		Name:     l.Name,
+		Level:    l,
+		Entities: map[*Entity]EntityView{},
+		Items:    map[Point]rune{},
+		Messages: messages,
+	}
+	width := 0
+	if len(l.Game) > 0 {
+		width = len(l.Game[0])
+	}
+	f.index = NewSpatialIndex(width, len(l.Game))
+	for _, e := range l.ListEntities() {
+		v := viewOf(e)
+		f.Entities[e] = v
+		if v.Components&PositionComponent != 0 {
+			f.index.Insert(e, v.Position)
+		}
+	}
+	l.mutex.Lock()
+	for p, pile := range l.Items {
+		f.Items[p] = pile[len(pile)-1].Def.Symbol
+	}
+	l.mutex.Unlock()
+	return f
+}
+
+// viewOf copies e's components into an EntityView.
+func viewOf(e *Entity) EntityView {
+	v := EntityView{Entity: e, Components: e.Components(), Inventory: e.InventoryList()}
+	v.Position, _ = e.Position()
+	v.Health, _ = e.Health()
+	v.Stats, _ = e.Stats()
+	v.Renderable, _ = e.Renderable()
+	return v
+}
+
+// View returns e as it was in the frame, and ok if it was on the level.
+func (f *Frame) View(e *Entity) (EntityView, bool) {
+	v, ok := f.Entities[e]
+	return v, ok
+}
+
+// EntitiesInRect is Level.EntitiesInRect, as of the frame.
+func (f *Frame) EntitiesInRect(x, y, width, height int) []EntityView {
+	var ret []EntityView
+	for _, e := range f.index.InRect(x, y, width, height) {
+		ret = append(ret, f.Entities[e])
+	}
+	return ret
+}
+
+// MessagesFor is Messages.For, as of the frame.
+func (f *Frame) MessagesFor(viewer *Entity) []Message {
+	return messagesFor(f.Messages, viewer)
+}
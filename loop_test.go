@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Several players moving, fighting and reading their screens at once, with
+// spectators switching between them, must not race; run with -race.
+func TestGameLoop_Clients(t *testing.T) {
+	*seed = 1
+	if err := LoadItemDefs(*itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadKeyMap(KeyMapPath(*keysName)); err != nil {
+		t.Fatal(err)
+	}
+	if err := newGame(); err != nil {
+		t.Fatal(err)
+	}
+	startGameLoop(t)
+
+	keys := []string{"\x1bOA", "\x1bOB", "\x1bOC", "\x1bOD", ".", ",", "i", "\x1b", "\x10", "\x1bOA", "\x1b"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		in, typing := io.Pipe()
+		tbox := termbox.NewClient()
+		if err := tbox.InitRemote(in, ioutil.Discard, 80, 24); err != nil {
+			t.Fatal(err)
+		}
+		player := joinPlayer(nil)
+		if player == nil {
+			t.Fatal("no room for player", i)
+		}
+		session := &Session{Name: fmt.Sprint("player ", i), Client: tbox, Player: player}
+		gameLoop.Do(func() { roster.Add(session) })
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer tbox.Close()
+			defer leavePlayer(player)
+			defer gameLoop.Do(func() { roster.Remove(session) })
+			session.Run()
+		}()
+		go func() {
+			for j := 0; j < 5; j++ {
+				for _, k := range keys {
+					typing.Write([]byte(k))
+					time.Sleep(time.Millisecond)
+				}
+			}
+			typing.Close()
+		}()
+	}
+	for i := 0; i < 2; i++ {
+		in, typing := io.Pipe()
+		tbox := termbox.NewClient()
+		if err := tbox.InitRemote(in, ioutil.Discard, 80, 24); err != nil {
+			t.Fatal(err)
+		}
+		spectator := &Spectator{Client: tbox}
+		spectator.Watch(roster.List()[i])
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer tbox.Close()
+			spectator.Run()
+		}()
+		go func() {
+			for j := 0; j < 20; j++ {
+				for _, k := range []string{"\t", "\x1bOD", "\x1bOA", "n"} {
+					typing.Write([]byte(k))
+					time.Sleep(time.Millisecond)
+				}
+			}
+			typing.Write([]byte("q"))
+			typing.Close()
+		}()
+	}
+	wg.Wait()
+
+	if len(roster.List()) != 0 {
+		t.Errorf("%v sessions still on the roster after leaving", len(roster.List()))
+	}
+
+	f, _ := gameLoop.Frame(world.Top())
+	if f.Turn == 0 {
+		t.Errorf("no turns were played")
+	}
+	for e := range f.Entities {
+		if e.AIName() == "player" {
+			t.Errorf("player still on the level after leaving")
+		}
+	}
+}
+
+// startGameLoop runs a new game loop until the test is over, waiting for it
+// to finish with the world before the next test replaces it.
+func startGameLoop(t *testing.T) {
+	gameLoop = NewGameLoop()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		gameLoop.Run()
+	}()
+	t.Cleanup(func() {
+		gameLoop.Stop()
+		<-done
+	})
+}
@@ -0,0 +1,423 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"shogun/generate"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Level files are loosely modeled on NetHack's .des files:
+//
+//	# Comments and blank lines are ignored outside the map.
+//	LEVEL: "Harbor"
+//	SIZE: 150x30
+//	LEGEND: ',' floor
+//	MAP
+//	#####
+//	#,,,#
+//	#####
+//	ENDMAP
+//	MONSTER: 'm', random, (5,5)
+//	OBJECT: "gold", (30,4)
+//	START: (2,1)
+//	POI: (3,1)
+//
+// LEGEND maps a glyph used in the map to a tile type by name, see Tiles, so
+// maps may draw with whatever characters are convenient. Glyphs without a
+// legend entry must already be a tile's glyph. MONSTER names the AI driving the
+// monster, see AIs. There may be any number of MONSTER, OBJECT, START and
+// POI lines; players join at the START points, and wandering monsters
+// walk between the POIs, points of interest. The stairs, '<' and '>', lead
+// to the levels above and below; see World.Level for where those come from.
+
+type Point struct {
+	X, Y int
+}
+
+type MonsterSpawn struct {
+	Symbol rune
+	AI     string
+	Point
+}
+
+type ObjectSpawn struct {
+	Name string
+	Point
+}
+
+// MapFile is a parsed level file.
+type MapFile struct {
+	Name     string
+	Legend   map[byte]string
+	Map      [][]byte
+	Monsters []MonsterSpawn
+	Objects  []ObjectSpawn
+	Starts   []Point
+	POIs     []Point
+}
+
+var mapName = flag.String("map", "harbor", "level to play: a name in the levels directory, or a path to a .des file")
+var generator = flag.String("generate", "", "generate random levels with this generator instead of loading -map and the levels below it: "+strings.Join(generate.Names(), ", "))
+var generateSize = flag.String("gensize", "120x40", "size of generated levels, as WIDTHxHEIGHT")
+var levelsDir = flag.String("levels", dataPath("levels"), "directory holding the level files")
+
+// dataPath finds the game's data file or directory rel, as laid out in the
+// source tree: beside the executable if it's there, as when the game's
+// installed along with its data, or else under the working directory, as
+// when it's run from the source tree.
+func dataPath(rel string) string {
+	if exe, err := os.Executable(); err == nil {
+		path := filepath.Join(filepath.Dir(exe), rel)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return rel
+}
+
+// MapPath resolves a -map value: either a path to a level file, or the
+// name of one in the levels directory.
+func MapPath(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || filepath.Ext(name) == ".des" {
+		return name
+	}
+	return filepath.Join(*levelsDir, name+".des")
+}
+
+func LoadMapFile(path string) (*MapFile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mf, err := ParseMapFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%v", path, err)
+	}
+	return mf, nil
+}
+
+// ParseMapFile reads a level file. Errors are prefixed with the line
+// number they were found on.
+func ParseMapFile(r io.Reader) (*MapFile, error) {
+	mf := &MapFile{Legend: map[byte]string{}}
+	width, height := -1, -1
+	inMap, sawMap := false, false
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	lineNo := 0
+	fail := func(format string, args ...interface{}) (*MapFile, error) {
+		return nil, fmt.Errorf("%v: %v", lineNo, fmt.Sprintf(format, args...))
+	}
+	for scanner.Scan() {
+		lineNo++
+		line := scanner.Text()
+		if inMap {
+			if strings.TrimSpace(line) == "ENDMAP" {
+				inMap = false
+				continue
+			}
+			mf.Map = append(mf.Map, []byte(line))
+			continue
+		}
+
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line == "MAP" {
+			if sawMap {
+				return fail("second MAP section")
+			}
+			inMap, sawMap = true, true
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i == -1 {
+			return fail("expected KEYWORD: value, got %q", line)
+		}
+		key, val := line[:i], strings.TrimSpace(line[i+1:])
+		args := splitArgs(val)
+
+		switch key {
+		case "LEVEL":
+			name, err := strconv.Unquote(val)
+			if err != nil {
+				return fail("LEVEL wants a quoted name, got %v", val)
+			}
+			mf.Name = name
+		case "SIZE":
+			if _, err := fmt.Sscanf(val, "%dx%d", &width, &height); err != nil {
+				return fail("SIZE wants WIDTHxHEIGHT, got %v", val)
+			}
+		case "LEGEND":
+			fields := strings.Fields(val)
+			if len(fields) != 2 {
+				return fail("LEGEND wants a glyph and a tile type, got %v", val)
+			}
+			glyph, err := parseGlyph(fields[0])
+			if err != nil || glyph > 0x7f {
+				return fail("bad LEGEND glyph %v", fields[0])
+			}
+			if _, ok := TileNamed(fields[1]); !ok {
+				return fail("unknown tile type %q", fields[1])
+			}
+			mf.Legend[byte(glyph)] = fields[1]
+		case "MONSTER":
+			if len(args) != 3 {
+				return fail("MONSTER wants 'symbol', ai, (x,y), got %v", val)
+			}
+			symbol, err := parseGlyph(args[0])
+			if err != nil {
+				return fail("bad MONSTER symbol %v", args[0])
+			}
+			if _, ok := AIs[args[1]]; !ok {
+				return fail("unknown AI %q", args[1])
+			}
+			p, err := parsePoint(args[2])
+			if err != nil {
+				return fail("%v", err)
+			}
+			mf.Monsters = append(mf.Monsters, MonsterSpawn{symbol, args[1], p})
+		case "OBJECT":
+			if len(args) != 2 {
+				return fail("OBJECT wants \"name\", (x,y), got %v", val)
+			}
+			name, err := strconv.Unquote(args[0])
+			if err != nil {
+				return fail("OBJECT wants a quoted name, got %v", args[0])
+			}
+			p, err := parsePoint(args[1])
+			if err != nil {
+				return fail("%v", err)
+			}
+			mf.Objects = append(mf.Objects, ObjectSpawn{name, p})
+		case "START":
+			p, err := parsePoint(val)
+			if err != nil {
+				return fail("%v", err)
+			}
+			mf.Starts = append(mf.Starts, p)
+		case "POI":
+			p, err := parsePoint(val)
+			if err != nil {
+				return fail("%v", err)
+			}
+			mf.POIs = append(mf.POIs, p)
+		default:
+			return fail("unknown keyword %v", key)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if inMap {
+		return fail("MAP without ENDMAP")
+	}
+	if len(mf.Map) == 0 {
+		return fail("no MAP section")
+	}
+
+	// Check the map's shape and translate it through the legend.
+	if width == -1 {
+		width, height = len(mf.Map[0]), len(mf.Map)
+	}
+	if len(mf.Map) != height {
+		return fail("map has %v rows, SIZE says %v", len(mf.Map), height)
+	}
+	for y, row := range mf.Map {
+		if len(row) != width {
+			return fail("map row %v is %v wide, want %v", y, len(row), width)
+		}
+		for x, c := range row {
+			if name, ok := mf.Legend[c]; ok {
+				t, _ := TileNamed(name)
+				row[x] = t.Glyph
+			} else if _, ok := Tiles[c]; !ok {
+				return fail("map glyph %q at (%v,%v) isn't a tile type or in the LEGEND", c, x, y)
+			}
+		}
+	}
+	in := func(p Point) bool {
+		return p.X >= 0 && p.Y >= 0 && p.X < width && p.Y < height
+	}
+	for _, m := range mf.Monsters {
+		if !in(m.Point) {
+			return fail("MONSTER %q at %v is off the map", m.Symbol, m.Point)
+		}
+	}
+	for _, o := range mf.Objects {
+		if !in(o.Point) {
+			return fail("OBJECT %q at %v is off the map", o.Name, o.Point)
+		}
+	}
+	if len(mf.Starts) == 0 {
+		return fail("no START")
+	}
+	for _, p := range mf.Starts {
+		if !in(p) {
+			return fail("START %v is off the map", p)
+		}
+	}
+	for _, p := range mf.POIs {
+		if !in(p) {
+			return fail("POI %v is off the map", p)
+		}
+	}
+	return mf, nil
+}
+
+// NewLevel builds a level from the map file, placing its objects and
+// spawning its monsters. Objects must name entries in ItemDefs.
+func (mf *MapFile) NewLevel() (*Level, error) {
+	l := &Level{Name: mf.Name, Starts: mf.Starts, POIs: mf.POIs}
+	for _, row := range mf.Map {
+		l.Game = append(l.Game, append([]byte(nil), row...))
+	}
+	for _, o := range mf.Objects {
+		item, err := NewItem(o.Name, 1)
+		if err != nil {
+			return nil, err
+		}
+		l.AddItem(o.X, o.Y, item)
+	}
+	for _, m := range mf.Monsters {
+		e := makeEntity(m.X, m.Y, m.Symbol)
+		e.StartAI(m.AI)
+		l.RegisterEntity(e)
+	}
+	return l, nil
+}
+
+// What a generated level is stocked with.
+const (
+	generatedStarts   = 3
+	generatedPOIs     = 6
+	generatedItems    = 6
+	generatedMonsters = 3
+)
+
+// generatedSpawns are the monsters generated levels pick from.
+var generatedSpawns = []MonsterSpawn{
+	{Symbol: 'm', AI: "random"},
+	{Symbol: 'r', AI: "hunter"},
+	{Symbol: 'c', AI: "wander"},
+}
+
+// generatedSize reads the -gensize flag.
+func generatedSize() (int, int, error) {
+	var width, height int
+	if _, err := fmt.Sscanf(*generateSize, "%dx%d", &width, &height); err != nil {
+		return 0, 0, fmt.Errorf("-gensize wants WIDTHxHEIGHT, got %v", *generateSize)
+	}
+	return width, height, nil
+}
+
+// GenerateMapFile makes a level with the named generator, see package
+// generate, seeded with seed. Its stairs, START points, POIs, monsters and
+// items are scattered over open floor with GlobalRNG; stairs lists the
+// stair glyphs to put down.
+func GenerateMapFile(name string, width, height int, seed int64, stairs ...byte) (*MapFile, error) {
+	m, err := generate.Generate(name, width, height, seed)
+	if err != nil {
+		return nil, err
+	}
+	mf := &MapFile{Name: fmt.Sprintf("%v %v", name, seed), Legend: map[byte]string{}, Map: m}
+
+	var open []Point
+	for y, row := range m {
+		for x, c := range row {
+			if generate.Walkable(c) {
+				open = append(open, Point{x, y})
+			}
+		}
+	}
+	// Each spot is used once, so nothing starts on top of anything else.
+	pick := func() Point {
+		if len(open) == 0 {
+			return Point{}
+		}
+		i := GlobalRNG.Intn(len(open))
+		p := open[i]
+		open = append(open[:i], open[i+1:]...)
+		return p
+	}
+	for _, c := range stairs {
+		p := pick()
+		m[p.Y][p.X] = c
+	}
+	for i := 0; i < generatedStarts; i++ {
+		mf.Starts = append(mf.Starts, pick())
+	}
+	for i := 0; i < generatedPOIs; i++ {
+		mf.POIs = append(mf.POIs, pick())
+	}
+	for i := 0; i < generatedMonsters; i++ {
+		spawn := generatedSpawns[GlobalRNG.Intn(len(generatedSpawns))]
+		spawn.Point = pick()
+		mf.Monsters = append(mf.Monsters, spawn)
+	}
+	var items []string
+	for name := range ItemDefs {
+		items = append(items, name)
+	}
+	sort.Strings(items)
+	for i := 0; i < generatedItems && len(items) > 0; i++ {
+		mf.Objects = append(mf.Objects, ObjectSpawn{items[GlobalRNG.Intn(len(items))], pick()})
+	}
+	return mf, nil
+}
+
+// splitArgs splits a comma separated argument list, leaving commas inside
+// quotes and parentheses alone.
+func splitArgs(s string) []string {
+	var args []string
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(s[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(s[start:]))
+}
+
+// parseGlyph reads a quoted character such as 'm'.
+func parseGlyph(s string) (rune, error) {
+	r, _, tail, err := strconv.UnquoteChar(strings.TrimPrefix(s, "'"), '\'')
+	if err != nil || len(s) < 3 || s[0] != '\'' || tail != "'" {
+		return 0, fmt.Errorf("bad glyph %v", s)
+	}
+	return r, nil
+}
+
+// parsePoint reads a position such as (5,12).
+func parsePoint(s string) (Point, error) {
+	var p Point
+	if _, err := fmt.Sscanf(strings.Replace(s, " ", "", -1), "(%d,%d)", &p.X, &p.Y); err != nil {
+		return p, fmt.Errorf("bad position %v, want (x,y)", s)
+	}
+	return p, nil
+}
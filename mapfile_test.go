@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMapFile_Errors(t *testing.T) {
+	// Each level is broken in one way, and the error should say where.
+	for _, test := range []struct {
+		des  string
+		want string
+	}{
+		{"", "no MAP section"},
+		{"MAP\n...\n", "MAP without ENDMAP"},
+		{"MAP\n...\nENDMAP\nMAP\n...\nENDMAP\n", "4: second MAP section"},
+		{"LEVEL Harbor\n", "1: expected KEYWORD: value"},
+		{"COLOR: red\n", "1: unknown keyword COLOR"},
+		{"LEVEL: Harbor\n", "1: LEVEL wants a quoted name"},
+		{"\nSIZE: big\n", "2: SIZE wants WIDTHxHEIGHT"},
+		{"LEGEND: x\n", "1: LEGEND wants a glyph and a tile type"},
+		{"LEGEND: 'x' lava\n", `1: unknown tile type "lava"`},
+		{"MONSTER: 'r', hunter\n", "1: MONSTER wants"},
+		{"MONSTER: 'r', dragon, (1,1)\n", `1: unknown AI "dragon"`},
+		{"MONSTER: 'r', hunter, 1 1\n", "1: "},
+		{"OBJECT: dagger, (1,1)\n", "1: OBJECT wants a quoted name"},
+		{"START: (1)\n", "1: "},
+		{"SIZE: 3x2\nMAP\n...\nENDMAP\nSTART: (0,0)\n", "map has 1 rows, SIZE says 2"},
+		{"MAP\n...\n..\nENDMAP\nSTART: (0,0)\n", "map row 1 is 2 wide, want 3"},
+		{"MAP\n.x.\nENDMAP\nSTART: (0,0)\n", `map glyph 'x' at (1,0)`},
+		{"MAP\n...\nENDMAP\n", "no START"},
+		{"MAP\n...\nENDMAP\nSTART: (3,0)\n", "4: START"},
+		{"MAP\n...\nENDMAP\nSTART: (0,0)\nPOI: (0,-1)\n", "5: POI"},
+		{"MAP\n...\nENDMAP\nSTART: (0,0)\nMONSTER: 'r', hunter, (0,1)\n", "off the map"},
+		{"MAP\n...\nENDMAP\nSTART: (0,0)\nOBJECT: \"dagger\", (9,9)\n", "off the map"},
+	} {
+		mf, err := ParseMapFile(strings.NewReader(test.des))
+		if err == nil {
+			t.Errorf("ParseMapFile(%q) = %+v, want an error", test.des, mf)
+			continue
+		}
+		if !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseMapFile(%q): %v, want it to mention %q", test.des, err, test.want)
+		}
+	}
+}
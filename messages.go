@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"sync"
+	"time"
+)
+
+// How many messages the log keeps before forgetting the oldest.
+const maxMessages = 1000
+
+// How many of the latest messages show above the map.
+const messagePaneLines = 4
+
+/*
+ *  Messages struct and methods.
+ */
+
+// A Message is one line of the message log.
+type Message struct {
+	Text string
+	Time time.Time
+	// The game turn it was sent during.
+	Turn int
+	// Who the message is for, or nil for everyone.
+	To *Entity
+}
+
+// String formats the message for the history viewer.
+func (m Message) String() string {
+	return fmt.Sprintf("%v  turn %-4v %v", m.Time.Format("15:04:05"), m.Turn, m.Text)
+}
+
+// Messages is the game's message log. AIs, sessions and the scheduler all
+// write to it from their own goroutines.
+type Messages struct {
+	messages []Message
+	// The turn new messages are stamped with.
+	turn  int
+	mutex sync.Mutex
+}
+
+func NewMessages() *Messages {
+	return &Messages{}
+}
+
+// Broadcast logs a message for every player.
+func (m *Messages) Broadcast(mes string) {
+	m.Send(nil, mes)
+}
+
+// Send logs a message that only to will see. A nil to means everyone.
+func (m *Messages) Send(to *Entity, mes string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.add(Message{Text: mes, Time: time.Now(), Turn: m.turn, To: to})
+}
+
+func (m *Messages) add(mes Message) {
+	m.messages = append(m.messages, mes)
+	if len(m.messages) > maxMessages {
+		m.messages = append([]Message(nil), m.messages[len(m.messages)-maxMessages:]...)
+	}
+}
+
+// SetTurn sets the turn number later messages are stamped with.
+func (m *Messages) SetTurn(turn int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.turn = turn
+}
+
+// For returns the messages viewer may read, oldest first.
+func (m *Messages) For(viewer *Entity) []Message {
+	return messagesFor(m.All(), viewer)
+}
+
+func messagesFor(msgs []Message, viewer *Entity) []Message {
+	var ret []Message
+	for _, mes := range msgs {
+		if mes.To == nil || mes.To == viewer {
+			ret = append(ret, mes)
+		}
+	}
+	return ret
+}
+
+// All returns a copy of the whole log, for saving and for frames.
+func (m *Messages) All() []Message {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]Message(nil), m.messages...)
+}
+
+/*
+ *  Drawing the log.
+ */
+
+// drawMessages draws viewer's latest messages in f at the top of the
+// screen, newest at the bottom.
+func drawMessages(tbox *termbox.TermClient, f *Frame, viewer *Entity) {
+	msgs := f.MessagesFor(viewer)
+	if len(msgs) > messagePaneLines {
+		msgs = msgs[len(msgs)-messagePaneLines:]
+	}
+	for y, mes := range msgs {
+		// Older lines fade so the newest stands out.
+		fg := termbox.ColorWhite
+		if y < len(msgs)-1 {
+			fg = rememberedColor
+		}
+		drawString(tbox, 0, y, mes.Text, fg)
+	}
+}
+
+// drawHistory fills the screen with viewer's message history in f. scroll
+// is how many lines back from the newest the bottom of the screen shows;
+// it's clamped to the history and the clamped value returned.
+func drawHistory(tbox *termbox.TermClient, f *Frame, viewer *Entity, scroll int) int {
+	msgs := f.MessagesFor(viewer)
+	w, h := tbox.Size()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			tbox.SetCell(x, y, ' ', termbox.ColorWhite, termbox.ColorBlack)
+		}
+	}
+	drawString(tbox, 0, 0, "Message history. Arrows, PgUp/PgDn or the mouse wheel scroll; Esc closes.", termbox.ColorYellow)
+
+	rows := h - 1
+	if max := len(msgs) - rows; scroll > max {
+		scroll = max
+	}
+	if scroll < 0 {
+		scroll = 0
+	}
+	end := len(msgs) - scroll
+	start := end - rows
+	if start < 0 {
+		start = 0
+	}
+	for i, mes := range msgs[start:end] {
+		drawString(tbox, 0, 1+i, mes.String(), termbox.ColorWhite)
+	}
+	return scroll
+}
+
+func drawString(tbox *termbox.TermClient, x, y int, s string, fg termbox.Attribute) {
+	for i, c := range []rune(s) {
+		tbox.SetCell(x+i, y, c, fg, termbox.ColorBlack)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Players and AIs write to the log and read it at once; run with -race.
+func TestMessages_Concurrent(t *testing.T) {
+	m := NewMessages()
+	const writers, each = 8, 50
+	players := make([]*Entity, writers)
+	for i := range players {
+		players[i] = newEntity()
+	}
+	var wg sync.WaitGroup
+	for i, p := range players {
+		wg.Add(1)
+		go func(i int, p *Entity) {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				m.Send(p, fmt.Sprint("to ", i))
+				m.Broadcast(fmt.Sprint("from ", i))
+				m.SetTurn(j)
+				m.For(p)
+			}
+		}(i, p)
+	}
+	wg.Wait()
+
+	if got, want := len(m.All()), 2*writers*each; got != want {
+		t.Errorf("logged %v messages, want %v", got, want)
+	}
+	for i, p := range players {
+		mine := 0
+		for _, mes := range m.For(p) {
+			if mes.To == p {
+				mine++
+			}
+			if mes.To != nil && mes.To != p {
+				t.Fatalf("player %v can read %q, sent to someone else", i, mes.Text)
+			}
+		}
+		if mine != each {
+			t.Errorf("player %v has %v messages of its own, want %v", i, mine, each)
+		}
+	}
+
+	// The log forgets the oldest past its limit.
+	for i := 0; i < maxMessages; i++ {
+		m.Broadcast("more")
+	}
+	if all := m.All(); len(all) != maxMessages || all[0].Text != "more" {
+		t.Errorf("log holds %v messages starting %q, want %v starting %q", len(all), all[0].Text, maxMessages, "more")
+	}
+}
@@ -0,0 +1,142 @@
+// Package pathfind finds shortest paths across tile maps with A*.
+package pathfind
+
+import (
+	"container/heap"
+)
+
+// A Point is a tile position.
+type Point struct {
+	X, Y int
+}
+
+// A Grid is a map to find paths across.
+type Grid interface {
+	// Passable reports whether a path may go through x, y. It's never
+	// asked about the start of a path, but is about the end: a grid that
+	// blocks occupied tiles should let through the one being chased.
+	Passable(x, y int) bool
+}
+
+// The steps a path may take between tiles, the same eight an entity can
+// move in: up, down, left and right, then the diagonals.
+var steps = []Point{{0, -1}, {0, 1}, {-1, 0}, {1, 0}, {-1, -1}, {1, -1}, {-1, 1}, {1, 1}}
+
+// What a step costs: diagonals a little more than straight steps, about
+// 14 to 10 as on the plane, so paths don't zigzag when a straight line is
+// as short.
+const (
+	straightCost = 10
+	diagonalCost = 14
+)
+
+// Find returns the shortest path from from to to, not including from, and
+// ok if there is one. It gives up after looking at limit tiles, so a
+// search for somewhere unreachable on a big map stays cheap; 0 means no
+// limit. Ties between equally short paths always break the same way.
+func Find(g Grid, from, to Point, limit int) ([]Point, bool) {
+	if from == to {
+		return nil, true
+	}
+	open := &queue{}
+	came := map[Point]Point{}
+	cost := map[Point]int{from: 0}
+	heap.Push(open, &node{p: from, f: Distance(from, to)})
+	seen := 0
+	for open.Len() > 0 {
+		n := heap.Pop(open).(*node)
+		if n.p == to {
+			return walkBack(came, from, to), true
+		}
+		if n.g > cost[n.p] {
+			continue // A shorter way here was already expanded.
+		}
+		seen++
+		if limit > 0 && seen > limit {
+			break
+		}
+		for _, s := range steps {
+			next := Point{n.p.X + s.X, n.p.Y + s.Y}
+			if !g.Passable(next.X, next.Y) {
+				continue
+			}
+			g2 := n.g + straightCost
+			if s.X != 0 && s.Y != 0 {
+				g2 = n.g + diagonalCost
+			}
+			if old, ok := cost[next]; ok && old <= g2 {
+				continue
+			}
+			cost[next] = g2
+			came[next] = n.p
+			open.order++
+			heap.Push(open, &node{p: next, g: g2, f: g2 + Distance(next, to), order: open.order})
+		}
+	}
+	return nil, false
+}
+
+func walkBack(came map[Point]Point, from, to Point) []Point {
+	var path []Point
+	for p := to; p != from; p = came[p] {
+		path = append(path, p)
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path
+}
+
+// Distance is the octile distance from a to b, in the units steps cost:
+// the length of the shortest path between them when nothing is in the way.
+func Distance(a, b Point) int {
+	dx, dy := abs(a.X-b.X), abs(a.Y-b.Y)
+	if dx < dy {
+		dx, dy = dy, dx
+	}
+	return straightCost*(dx-dy) + diagonalCost*dy
+}
+
+func abs(i int) int {
+	if i < 0 {
+		return -i
+	}
+	return i
+}
+
+/*
+ *  Priority queue of nodes to visit.
+ */
+
+type node struct {
+	p Point
+	// Cost so far, and estimated total cost through p.
+	g, f int
+	// When the node was queued, to break ties first come first served.
+	order int
+}
+
+type queue struct {
+	nodes []*node
+	order int
+}
+
+func (q *queue) Len() int { return len(q.nodes) }
+
+func (q *queue) Less(i, j int) bool {
+	a, b := q.nodes[i], q.nodes[j]
+	if a.f != b.f {
+		return a.f < b.f
+	}
+	return a.order < b.order
+}
+
+func (q *queue) Swap(i, j int) { q.nodes[i], q.nodes[j] = q.nodes[j], q.nodes[i] }
+
+func (q *queue) Push(x interface{}) { q.nodes = append(q.nodes, x.(*node)) }
+
+func (q *queue) Pop() interface{} {
+	n := q.nodes[len(q.nodes)-1]
+	q.nodes = q.nodes[:len(q.nodes)-1]
+	return n
+}
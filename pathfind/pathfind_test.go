@@ -0,0 +1,93 @@
+package pathfind
+
+import (
+	"testing"
+)
+
+// A grid drawn as strings, '#' for walls.
+type rows []string
+
+func (r rows) Passable(x, y int) bool {
+	return y >= 0 && y < len(r) && x >= 0 && x < len(r[y]) && r[y][x] != '#'
+}
+
+func TestFind_AroundWall(t *testing.T) {
+	g := rows{
+		".....",
+		".###.",
+		"...#.",
+	}
+	path, ok := Find(g, Point{0, 2}, Point{4, 2}, 0)
+	if !ok {
+		t.Fatal("no path found")
+	}
+	if len(path) != 6 {
+		t.Errorf("path %v has %v steps, want 6", path, len(path))
+	}
+	if path[len(path)-1] != (Point{4, 2}) {
+		t.Errorf("path %v doesn't end at the goal", path)
+	}
+	prev := Point{0, 2}
+	for _, p := range path {
+		if !g.Passable(p.X, p.Y) || abs(p.X-prev.X) > 1 || abs(p.Y-prev.Y) > 1 {
+			t.Fatalf("path %v takes a bad step to %v", path, p)
+		}
+		prev = p
+	}
+}
+
+func TestFind_Diagonal(t *testing.T) {
+	g := rows{
+		".....",
+		".....",
+		".....",
+	}
+	// Two diagonal steps and two straight ones, not six straight.
+	path, _ := Find(g, Point{0, 0}, Point{4, 2}, 0)
+	if len(path) != 4 {
+		t.Errorf("path %v has %v steps, want 4", path, len(path))
+	}
+	if d := Distance(Point{0, 0}, Point{4, 2}); d != 2*diagonalCost+2*straightCost {
+		t.Errorf("Distance is %v, want %v", d, 2*diagonalCost+2*straightCost)
+	}
+}
+
+func TestFind_Unreachable(t *testing.T) {
+	g := rows{
+		"..#..",
+		"..#..",
+	}
+	if path, ok := Find(g, Point{0, 0}, Point{4, 1}, 0); ok {
+		t.Errorf("found path %v through a wall", path)
+	}
+}
+
+func TestFind_Limit(t *testing.T) {
+	g := rows{
+		"..........",
+		"..........",
+	}
+	if _, ok := Find(g, Point{0, 0}, Point{9, 1}, 3); ok {
+		t.Errorf("found a 10 step path looking at only 3 tiles")
+	}
+	if _, ok := Find(g, Point{0, 0}, Point{9, 1}, 0); !ok {
+		t.Errorf("no path without a limit")
+	}
+}
+
+func TestFind_Deterministic(t *testing.T) {
+	g := rows{
+		".....",
+		".....",
+		".....",
+	}
+	first, _ := Find(g, Point{0, 0}, Point{4, 2}, 0)
+	for i := 0; i < 10; i++ {
+		path, _ := Find(g, Point{0, 0}, Point{4, 2}, 0)
+		for j := range path {
+			if path[j] != first[j] {
+				t.Fatalf("paths differ: %v and %v", first, path)
+			}
+		}
+	}
+}
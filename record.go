@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sessions can be recorded: everything sent to the player's terminal, with
+// when it was sent. Each recording is written twice, as a ttyrec file, the
+// format of ttyrec and ttyplay, and as an asciicast v2 file, the format of
+// asciinema. `shogun replay` plays back either.
+
+var recordDir = flag.String("record", "", "directory to record every session in, as .ttyrec and .cast files; empty records nothing")
+
+// A Chunk is output sent to a terminal in one go, At its time into the
+// recording.
+type Chunk struct {
+	At   time.Duration
+	Data []byte
+}
+
+// The formats a Recorder writes.
+type recordFormat interface {
+	Output(c Chunk) error
+	Resize(at time.Duration, width, height int) error
+}
+
+/*
+ *  Recorder struct and methods.
+ */
+
+// A Recorder is an io.Writer that passes everything on to Out, recording
+// it as it goes. It's meant to stand in for a TermClient's Out. Recording
+// stops at the first error writing the files, which Close then returns;
+// Out is written to regardless.
+type Recorder struct {
+	Out     io.Writer
+	start   time.Time
+	files   []*os.File
+	formats []recordFormat
+	err     error
+	mutex   sync.Mutex
+}
+
+// NewRecorder starts recording output to out, for a width by height
+// terminal, in path plus .ttyrec and path plus .cast.
+func NewRecorder(out io.Writer, path string, width, height int) (*Recorder, error) {
+	r := &Recorder{Out: out, start: time.Now()}
+	for _, ext := range []string{".ttyrec", ".cast"} {
+		file, err := os.Create(path + ext)
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.files = append(r.files, file)
+	}
+	r.formats = []recordFormat{&ttyrecWriter{r.files[0], r.start}, &castWriter{w: r.files[1]}}
+	if err := r.formats[1].(*castWriter).header(r.start, width, height); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("%v:%v", r.files[1].Name(), err)
+	}
+	return r, nil
+}
+
+// recordSession starts recording a session's output under -record, naming
+// the files after the time and who. It returns nil if -record isn't set.
+func recordSession(out io.Writer, width, height int, who string) (*Recorder, error) {
+	if *recordDir == "" {
+		return nil, nil
+	}
+	who = strings.Map(func(r rune) rune {
+		if r == ':' || r == os.PathSeparator {
+			return '_'
+		}
+		return r
+	}, who)
+	name := fmt.Sprintf("%v-%v", time.Now().Format("20060102-150405"), who)
+	return NewRecorder(out, filepath.Join(*recordDir, name), width, height)
+}
+
+func (r *Recorder) Write(p []byte) (int, error) {
+	n, err := r.Out.Write(p)
+	r.record(func(f recordFormat, at time.Duration) error {
+		return f.Output(Chunk{at, p[:n]})
+	})
+	return n, err
+}
+
+// Resize records that the terminal is now width by height, where the
+// format has a way to say so.
+func (r *Recorder) Resize(width, height int) {
+	r.record(func(f recordFormat, at time.Duration) error {
+		return f.Resize(at, width, height)
+	})
+}
+
+func (r *Recorder) record(write func(f recordFormat, at time.Duration) error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err != nil {
+		return
+	}
+	at := time.Since(r.start)
+	for i, f := range r.formats {
+		if err := write(f, at); err != nil {
+			r.err = fmt.Errorf("%v:%v", r.files[i].Name(), err)
+			return
+		}
+	}
+}
+
+// Close finishes the recording's files.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	err := r.err
+	for _, file := range r.files {
+		if cerr := file.Close(); err == nil && cerr != nil {
+			err = cerr
+		}
+	}
+	r.files, r.formats = nil, nil
+	if r.err == nil {
+		r.err = fmt.Errorf("recording closed")
+	}
+	return err
+}
+
+/*
+ *  ttyrec.
+ */
+
+// A ttyrec file is a run of records, each a header of three little endian
+// uint32s, the wall clock seconds and microseconds it was written at and the
+// length of its data, then the data.
+
+type ttyrecWriter struct {
+	w     io.Writer
+	start time.Time
+}
+
+func (t *ttyrecWriter) Output(c Chunk) error {
+	at := t.start.Add(c.At)
+	header := [3]uint32{uint32(at.Unix()), uint32(at.Nanosecond() / 1000), uint32(len(c.Data))}
+	if err := binary.Write(t.w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	_, err := t.w.Write(c.Data)
+	return err
+}
+
+// ttyrec has no way to record a resize.
+func (t *ttyrecWriter) Resize(at time.Duration, width, height int) error {
+	return nil
+}
+
+// ParseTtyrec reads a ttyrec file, timing chunks from the first.
+func ParseTtyrec(r io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	var first time.Time
+	for i := 0; ; i++ {
+		var header [3]uint32
+		if err := binary.Read(r, binary.LittleEndian, &header); err == io.EOF {
+			return chunks, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("record %v: %v", i, err)
+		}
+		data := make([]byte, header[2])
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("record %v: %v", i, err)
+		}
+		at := time.Unix(int64(header[0]), int64(header[1])*1000)
+		if i == 0 {
+			first = at
+		}
+		chunks = append(chunks, Chunk{at.Sub(first), data})
+	}
+}
+
+/*
+ *  asciicast v2.
+ */
+
+// An asciicast v2 file is a line of JSON describing the recording, then a
+// line for each event, a JSON array of its time in seconds, its type, "o"
+// for output or "r" for a resize, and its data:
+//
+//	{"version": 2, "width": 80, "height": 24, "timestamp": 1504467315}
+//	[0.248848, "o", "\u001b[1;31mHello \u001b[32mWorld!\u001b[0m\n"]
+//	[1.001376, "r", "100x30"]
+
+type castHeader struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp,omitempty"`
+}
+
+type castWriter struct {
+	w io.Writer
+}
+
+func (c *castWriter) header(start time.Time, width, height int) error {
+	return c.line(castHeader{2, width, height, start.Unix()})
+}
+
+func (c *castWriter) line(v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(append(b, '\n'))
+	return err
+}
+
+func (c *castWriter) Output(ch Chunk) error {
+	return c.line([]interface{}{ch.At.Seconds(), "o", string(ch.Data)})
+}
+
+func (c *castWriter) Resize(at time.Duration, width, height int) error {
+	return c.line([]interface{}{at.Seconds(), "r", fmt.Sprintf("%vx%v", width, height)})
+}
+
+// ParseCast reads an asciicast v2 file's output. Errors are prefixed with
+// the line number they were found on.
+func ParseCast(r io.Reader) ([]Chunk, error) {
+	var chunks []Chunk
+	br := bufio.NewReader(r)
+	lineNo := 0
+	fail := func(format string, args ...interface{}) ([]Chunk, error) {
+		return nil, fmt.Errorf("%v: %v", lineNo, fmt.Sprintf(format, args...))
+	}
+	for {
+		// Lines can be far longer than a bufio.Scanner allows.
+		line, err := br.ReadBytes('\n')
+		if len(line) == 0 && err == io.EOF {
+			break
+		} else if err != nil && err != io.EOF {
+			return nil, err
+		}
+		lineNo++
+		line = bytes.TrimSpace(line)
+		if lineNo == 1 {
+			var h castHeader
+			if err := json.Unmarshal(line, &h); err != nil {
+				return fail("bad header: %v", err)
+			}
+			if h.Version != 2 {
+				return fail("asciicast version %v, want 2", h.Version)
+			}
+			continue
+		}
+		if len(line) == 0 {
+			continue
+		}
+		var event []interface{}
+		if err := json.Unmarshal(line, &event); err != nil {
+			return fail("%v", err)
+		}
+		if len(event) != 3 {
+			return fail("event wants a time, a type and data, got %s", line)
+		}
+		secs, ok1 := event[0].(float64)
+		kind, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fail("event wants a time, a type and data, got %s", line)
+		}
+		// Only output matters for playing back.
+		if kind == "o" {
+			chunks = append(chunks, Chunk{time.Duration(secs * float64(time.Second)), []byte(data)})
+		}
+	}
+	if lineNo == 0 {
+		return fail("empty file, want an asciicast header")
+	}
+	return chunks, nil
+}
+
+// LoadRecording reads a recording in either format, telling them apart by
+// asciicast's opening brace.
+func LoadRecording(path string) ([]Chunk, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	r := bufio.NewReader(file)
+	parse := ParseTtyrec
+	if b, err := r.Peek(1); err == nil && b[0] == '{' {
+		parse = ParseCast
+	}
+	chunks, err := parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("%v:%v", path, err)
+	}
+	return chunks, nil
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder_RoundTrip(t *testing.T) {
+	var out bytes.Buffer
+	path := filepath.Join(t.TempDir(), "session")
+	rec, err := NewRecorder(&out, path, 80, 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writes := []string{"\x1b[2J", "hello", "\x1b[1;1Hé"}
+	for i, w := range writes {
+		if i == 1 {
+			rec.Resize(100, 30)
+		}
+		rec.Write([]byte(w))
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != strings.Join(writes, "") {
+		t.Errorf("wrote %q through the recorder, want %q", out.String(), strings.Join(writes, ""))
+	}
+
+	for _, ext := range []string{".ttyrec", ".cast"} {
+		chunks, err := LoadRecording(path + ext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunks) != len(writes) {
+			t.Fatalf("%v: got %v chunks, want %v", ext, len(chunks), len(writes))
+		}
+		for i, c := range chunks {
+			if string(c.Data) != writes[i] {
+				t.Errorf("%v: chunk %v is %q, want %q", ext, i, c.Data, writes[i])
+			}
+			if i > 0 && c.At <= chunks[i-1].At {
+				t.Errorf("%v: chunk %v at %v, not after %v", ext, i, c.At, chunks[i-1].At)
+			}
+		}
+	}
+}
+
+func TestParseCast_Errors(t *testing.T) {
+	for _, cast := range []string{
+		"",
+		`{"version": 1, "width": 80, "height": 24}`,
+		"{\"version\": 2, \"width\": 80, \"height\": 24}\n[0.5, \"o\"]",
+		"{\"version\": 2, \"width\": 80, \"height\": 24}\n[\"soon\", \"o\", \"x\"]",
+	} {
+		if _, err := ParseCast(strings.NewReader(cast)); err == nil {
+			t.Errorf("ParseCast(%q) succeeded, want an error", cast)
+		}
+	}
+}
+
+func TestReplay_Seek(t *testing.T) {
+	chunks := []Chunk{
+		{0, []byte("a")},
+		{2 * time.Second, []byte("b")},
+		{4 * time.Second, []byte("c")},
+	}
+	var out bytes.Buffer
+	r := NewReplay(chunks, &out, 1)
+	out.Reset()
+
+	r.Seek(3 * time.Second)
+	if out.String() != "ab" {
+		t.Errorf("seeking forward wrote %q, want %q", out.String(), "ab")
+	}
+	out.Reset()
+	r.Seek(10 * time.Second)
+	if out.String() != "c" || r.Position() != r.Length() {
+		t.Errorf("seeking past the end wrote %q to %v, want %q to %v", out.String(), r.Position(), "c", r.Length())
+	}
+	// Going back redraws from the start.
+	out.Reset()
+	r.Seek(time.Second)
+	if out.String() != replayReset+"a" {
+		t.Errorf("seeking back wrote %q, want %q", out.String(), replayReset+"a")
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io"
+	"os"
+	"time"
+)
+
+// Replay speeds run from 1/maxSpeed to maxSpeed.
+const maxSpeed = 64
+
+// How far the arrow keys seek.
+const seekStep = 5 * time.Second
+
+// Clears the screen and resets colours before drawing a recording from the
+// start again.
+const replayReset = "\x1b[0m\x1b[H\x1b[2J"
+
+const replayUsage = `usage: shogun replay [-speed n] file
+
+Plays back a session recorded with -record, from its .ttyrec or .cast file.
+
+  Space  pause or carry on
+  + -    play twice or half as fast
+  ← →    seek back or forward 5 seconds
+  Home   back to the start
+  q      quit
+`
+
+// replayMain runs `shogun replay` with args, returning its exit status.
+func replayMain(args []string) int {
+	flags := flag.NewFlagSet("replay", flag.ContinueOnError)
+	speed := flags.Float64("speed", 1, "playback speed; 2 plays twice as fast")
+	flags.Usage = func() {
+		fmt.Fprint(os.Stderr, replayUsage)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return 2
+	}
+	chunks, err := LoadRecording(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+		return 1
+	}
+
+	tbox := termbox.NewClient()
+	if err := tbox.Init(); err != nil {
+		fmt.Fprintf(os.Stderr, "shogun: %v\n", err)
+		return 1
+	}
+	tbox.Out = os.Stdout
+	tbox.In = os.Stdin
+	defer tbox.Close()
+	tbox.SetInputMode(termbox.InputEsc)
+
+	keys := make(chan termbox.Event)
+	go func() {
+		for {
+			ev := tbox.PollEvent()
+			keys <- ev
+			if ev.Type == termbox.EventError {
+				return
+			}
+		}
+	}()
+	NewReplay(chunks, os.Stdout, *speed).Play(keys)
+	return 0
+}
+
+/*
+ *  Replay struct and methods.
+ */
+
+// A Replay plays a recording back to a terminal.
+type Replay struct {
+	chunks []Chunk
+	out    io.Writer
+	Speed  float64
+	Paused bool
+	// How far into the recording it's played, and the first chunk it's
+	// still to write.
+	pos  time.Duration
+	next int
+}
+
+func NewReplay(chunks []Chunk, out io.Writer, speed float64) *Replay {
+	r := &Replay{chunks: chunks, out: out}
+	r.SetSpeed(speed)
+	io.WriteString(out, replayReset)
+	return r
+}
+
+// Length is how long the recording runs.
+func (r *Replay) Length() time.Duration {
+	if len(r.chunks) == 0 {
+		return 0
+	}
+	return r.chunks[len(r.chunks)-1].At
+}
+
+// Position is how far into the recording it's played.
+func (r *Replay) Position() time.Duration {
+	return r.pos
+}
+
+// SetSpeed changes the playback speed, within 1/maxSpeed and maxSpeed.
+func (r *Replay) SetSpeed(speed float64) {
+	switch {
+	case speed > maxSpeed:
+		speed = maxSpeed
+	case speed < 1.0/maxSpeed:
+		speed = 1.0 / maxSpeed
+	}
+	r.Speed = speed
+}
+
+// Seek puts the terminal as it was at the time to into the recording. Going
+// back means drawing it all again from the start.
+func (r *Replay) Seek(to time.Duration) {
+	if to < 0 {
+		to = 0
+	}
+	if to > r.Length() {
+		to = r.Length()
+	}
+	var buf bytes.Buffer
+	if to < r.pos {
+		buf.WriteString(replayReset)
+		r.next = 0
+	}
+	for r.next < len(r.chunks) && r.chunks[r.next].At <= to {
+		buf.Write(r.chunks[r.next].Data)
+		r.next++
+	}
+	r.pos = to
+	r.out.Write(buf.Bytes())
+}
+
+// Play plays the recording from where it is, taking commands from keys, until
+// a quit key or keys closing. At the end it waits on the last screen, for a
+// key to seek back or quit.
+func (r *Replay) Play(keys <-chan termbox.Event) {
+	for {
+		// Play real time, scaled by the speed, from here to the next chunk.
+		var due <-chan time.Time
+		started := time.Now()
+		if !r.Paused && r.next < len(r.chunks) {
+			wait := float64(r.chunks[r.next].At-r.pos) / r.Speed
+			due = time.After(time.Duration(wait))
+		}
+		select {
+		case <-due:
+			r.Seek(r.chunks[r.next].At)
+			continue
+		case ev, ok := <-keys:
+			if !ok || ev.Type == termbox.EventError {
+				return
+			}
+			if !r.Paused && r.next < len(r.chunks) {
+				r.pos += time.Duration(float64(time.Since(started)) * r.Speed)
+				if r.pos > r.chunks[r.next].At {
+					r.pos = r.chunks[r.next].At
+				}
+			}
+			if ev.Type == termbox.EventKey && !r.Command(ev) {
+				return
+			}
+		}
+	}
+}
+
+// Command carries out the replay command ev is bound to, returning false if
+// it's quit.
+func (r *Replay) Command(ev termbox.Event) bool {
+	switch {
+	case ev.Ch == 'q', ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlC:
+		return false
+	case ev.Key == termbox.KeySpace, ev.Ch == 'p':
+		r.Paused = !r.Paused
+	case ev.Ch == '+', ev.Ch == '=':
+		r.SetSpeed(r.Speed * 2)
+	case ev.Ch == '-':
+		r.SetSpeed(r.Speed / 2)
+	case ev.Key == termbox.KeyArrowRight, ev.Ch == 'l':
+		r.Seek(r.pos + seekStep)
+	case ev.Key == termbox.KeyArrowLeft, ev.Ch == 'h':
+		r.Seek(r.pos - seekStep)
+	case ev.Key == termbox.KeyHome, ev.Ch == '0':
+		r.Seek(0)
+	}
+	return true
+}
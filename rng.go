@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ *  RNG struct and methods.
+ */
+
+// RNG is the game's single source of randomness. Every random decision in
+// the engine draws from it, so a game started with the same seed and fed
+// the same input plays out the same way.
+type RNG struct {
+	seed  int64
+	src   *countingSource
+	r     *rand.Rand
+	mutex sync.Mutex
+}
+
+func NewRNG(seed int64) *RNG {
+	src := &countingSource{src: rand.NewSource(seed)}
+	return &RNG{seed: seed, src: src, r: rand.New(src)}
+}
+
+// RestoreRNG recreates an RNG that has already made draws draws from its
+// source, e.g. one saved along with a game.
+func RestoreRNG(seed, draws int64) *RNG {
+	g := NewRNG(seed)
+	for g.src.draws < draws {
+		g.src.Int63()
+	}
+	return g
+}
+
+func (g *RNG) Seed() int64 {
+	return g.seed
+}
+
+// Draws reports how far into its stream the RNG is. Together with the
+// seed it's enough to restore the RNG's state.
+func (g *RNG) Draws() int64 {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.src.draws
+}
+
+// Intn returns a number in [0, n).
+func (g *RNG) Intn(n int) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.r.Intn(n)
+}
+
+// Roll rolls num dice with the given number of sides and sums them.
+func (g *RNG) Roll(num, sides int) int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	ret := 0
+	for i := 0; i < num; i++ {
+		ret += g.r.Intn(sides) + 1
+	}
+	return ret
+}
+
+// Noise returns a number in [0, n) that depends only on the seed and vals.
+// It's for cosmetic randomness like animation, which runs at whatever rate
+// each client renders and so must not consume draws from the game's stream.
+func (g *RNG) Noise(n int, vals ...int) int {
+	h := uint64(g.seed)
+	for _, v := range vals {
+		h = splitmix64(h ^ uint64(v))
+	}
+	return int(splitmix64(h) % uint64(n))
+}
+
+// splitmix64 is the finalizer from Steele et al., "Fast splittable
+// pseudorandom number generators".
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// countingSource counts the values drawn from a rand.Source, since the
+// source's own state can't be saved.
+type countingSource struct {
+	src   rand.Source
+	draws int64
+}
+
+func (c *countingSource) Int63() int64 {
+	c.draws++
+	return c.src.Int63()
+}
+
+func (c *countingSource) Seed(seed int64) {
+	c.src.Seed(seed)
+	c.draws = 0
+}
+
+/*
+ *  Dice expressions.
+ */
+
+// Dice is a parsed dice expression such as 3d6+2.
+type Dice struct {
+	Num   int
+	Sides int
+	Bonus int
+}
+
+// ParseDice parses expressions of the form NdS, NdS+B, NdS-B, dS or a
+// plain number B.
+func ParseDice(s string) (Dice, error) {
+	var d Dice
+	expr := strings.TrimSpace(s)
+
+	// Split off the bonus.
+	if i := strings.LastIndexAny(expr, "+-"); i > 0 {
+		b, err := strconv.Atoi(expr[i:])
+		if err != nil {
+			return d, fmt.Errorf("bad dice %q: %v", s, err)
+		}
+		d.Bonus = b
+		expr = expr[:i]
+	}
+
+	i := strings.IndexAny(expr, "dD")
+	if i == -1 {
+		b, err := strconv.Atoi(expr)
+		if err != nil {
+			return d, fmt.Errorf("bad dice %q: %v", s, err)
+		}
+		d.Bonus += b
+		return d, nil
+	}
+
+	d.Num = 1
+	if i > 0 {
+		n, err := strconv.Atoi(expr[:i])
+		if err != nil || n < 0 {
+			return d, fmt.Errorf("bad dice %q: bad number of dice", s)
+		}
+		d.Num = n
+	}
+	sides, err := strconv.Atoi(expr[i+1:])
+	if err != nil || sides < 1 {
+		return d, fmt.Errorf("bad dice %q: bad number of sides", s)
+	}
+	d.Sides = sides
+	return d, nil
+}
+
+// MustParseDice is ParseDice for expressions written into the source.
+func MustParseDice(s string) Dice {
+	d, err := ParseDice(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func (d Dice) Roll(g *RNG) int {
+	if d.Num == 0 {
+		return d.Bonus
+	}
+	return g.Roll(d.Num, d.Sides) + d.Bonus
+}
+
+func (d Dice) String() string {
+	s := strconv.Itoa(d.Bonus)
+	if d.Num > 0 {
+		s = fmt.Sprintf("%vd%v", d.Num, d.Sides)
+		if d.Bonus != 0 {
+			s += fmt.Sprintf("%+d", d.Bonus)
+		}
+	}
+	return s
+}
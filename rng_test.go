@@ -0,0 +1,49 @@
+package main
+
+import "testing"
+
+func TestParseDice(t *testing.T) {
+	for _, test := range []struct {
+		in   string
+		want Dice
+	}{
+		{"d6", Dice{1, 6, 0}},
+		{"D6", Dice{1, 6, 0}},
+		{"2d6+3", Dice{2, 6, 3}},
+		{"3d4-1", Dice{3, 4, -1}},
+		{" 1d20 ", Dice{1, 20, 0}},
+		{"0d6", Dice{0, 6, 0}},
+		{"5", Dice{0, 0, 5}},
+		{"-2", Dice{0, 0, -2}},
+	} {
+		got, err := ParseDice(test.in)
+		if err != nil {
+			t.Errorf("ParseDice(%q): %v", test.in, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ParseDice(%q) = %+v, want %+v", test.in, got, test.want)
+		}
+	}
+
+	for _, in := range []string{"", "d", "2d", "d0", "xd6", "-1d6", "2x6", "2d6+", "2d6+x", "2d6+1+1", "2d-6"} {
+		if d, err := ParseDice(in); err == nil {
+			t.Errorf("ParseDice(%q) = %+v, want an error", in, d)
+		}
+	}
+}
+
+func TestRestoreRNG(t *testing.T) {
+	g := NewRNG(42)
+	g.Roll(3, 6)
+	g.Intn(1000)
+	restored := RestoreRNG(g.Seed(), g.Draws())
+	if restored.Draws() != g.Draws() {
+		t.Errorf("restored RNG has made %v draws, want %v", restored.Draws(), g.Draws())
+	}
+	for i := 0; i < 20; i++ {
+		if got, want := restored.Intn(1000), g.Intn(1000); got != want {
+			t.Fatalf("draw %v after restoring is %v, want %v", i, got, want)
+		}
+	}
+}
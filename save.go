@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// saveVersion is bumped whenever SaveFile changes shape, once a version
+// has been released. LoadGame refuses saves from other versions rather
+// than guessing at them.
+const saveVersion = 1
+
+// SaveFile is everything needed to resume a game, as written to disk.
+type SaveFile struct {
+	Version  int
+	Seed     int64
+	RNGDraws int64
+	Turn     int
+	// The levels built so far, top first. The rest are built when they're
+	// first visited, as usual.
+	Levels   []SavedLevel
+	Messages []SavedMessage
+}
+
+// SavedLevel is a Level and everything on it.
+type SavedLevel struct {
+	Depth    int
+	Name     string
+	Turn     int
+	Starts   []Point
+	POIs     []Point `json:",omitempty"`
+	Map      []string
+	Entities []SavedEntity
+	Items    []SavedFloorItem
+}
+
+// SavedEntity is an Entity's components, without its goroutine and
+// channels. Predicates aren't saved; newEntity rebuilds them.
+type SavedEntity struct {
+	// Which of the component fields below the entity has.
+	Components ComponentSet
+	Position   Position
+	Health     Health
+	Stats      Stats
+	// The Renderable.
+	Symbol string
+	Fg     termbox.Attribute
+	// The AIController's Name.
+	AI        string
+	Inventory []SavedItem `json:",omitempty"`
+	// The entity's TileMemory of each level by depth, as TileMemory.Rows.
+	Memories map[int][]string `json:",omitempty"`
+}
+
+// SavedMessage is a Message, with its recipient saved as a 1-based index
+// into the entities of all the SaveFile's Levels in turn, or 0 for
+// everyone.
+type SavedMessage struct {
+	Text string
+	Time time.Time
+	Turn int
+	To   int `json:",omitempty"`
+}
+
+// SavedItem is an Item, by the name of its definition.
+type SavedItem struct {
+	Name    string
+	Count   int
+	Wielded bool `json:",omitempty"`
+}
+
+// SavedFloorItem is an Item lying on the map.
+type SavedFloorItem struct {
+	Point
+	SavedItem
+}
+
+// savedItem is the inverse of SavedItem.item.
+func savedItem(i *Item) SavedItem {
+	return SavedItem{Name: i.Def.Name, Count: i.Count}
+}
+
+func (si SavedItem) item() (*Item, error) {
+	if si.Count < 1 {
+		return nil, fmt.Errorf("%v has count %v", si.Name, si.Count)
+	}
+	return NewItem(si.Name, si.Count)
+}
+
+// SaveGame writes the running game to path. Call it on the game loop, so
+// the save falls between turns.
+func SaveGame(path string) error {
+	sf := SaveFile{
+		Version:  saveVersion,
+		Seed:     GlobalRNG.Seed(),
+		RNGDraws: GlobalRNG.Draws(),
+		Turn:     world.Turn,
+	}
+	var entities []*Entity
+	for _, depth := range world.Depths() {
+		l := world.Levels[depth]
+		sl, saved := saveLevel(l)
+		sf.Levels = append(sf.Levels, sl)
+		entities = append(entities, saved...)
+	}
+	for _, mes := range GlobalMessages.All() {
+		sm := SavedMessage{Text: mes.Text, Time: mes.Time, Turn: mes.Turn}
+		if mes.To != nil {
+			for i, e := range entities {
+				if e == mes.To {
+					sm.To = i + 1
+				}
+			}
+			// Nobody left to read it.
+			if sm.To == 0 {
+				continue
+			}
+		}
+		sf.Messages = append(sf.Messages, sm)
+	}
+
+	data, err := json.MarshalIndent(sf, "", "\t")
+	if err != nil {
+		return err
+	}
+	return replaceFile(path, data)
+}
+
+// replaceFile writes data beside the file at path and swaps it in, so a
+// crash mid-write doesn't lose both.
+func replaceFile(path string, data []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// saveLevel returns l as saved, and its entities in the order saved.
+func saveLevel(l *Level) (SavedLevel, []*Entity) {
+	l.Scheduler.mutex.Lock()
+	sl := SavedLevel{
+		Depth:  l.Depth,
+		Name:   l.Name,
+		Turn:   l.Scheduler.Turn,
+		Starts: l.Starts,
+		POIs:   l.POIs,
+	}
+	l.Scheduler.mutex.Unlock()
+	for _, row := range l.Game {
+		sl.Map = append(sl.Map, string(row))
+	}
+	entities := l.ListEntities()
+	for _, e := range entities {
+		sl.Entities = append(sl.Entities, saveEntity(e))
+	}
+	l.mutex.Lock()
+	for p, pile := range l.Items {
+		for _, item := range pile {
+			sl.Items = append(sl.Items, SavedFloorItem{p, savedItem(item)})
+		}
+	}
+	l.mutex.Unlock()
+	return sl, entities
+}
+
+// saveEntity is the inverse of loadEntity.
+func saveEntity(e *Entity) SavedEntity {
+	se := SavedEntity{Components: e.Components()}
+	se.Position, _ = e.Position()
+	se.Health, _ = e.Health()
+	se.Stats, _ = e.Stats()
+	r, _ := e.Renderable()
+	se.Symbol, se.Fg = string(r.Symbol), r.Fg
+	se.AI = e.AIName()
+	e.mutex.Lock()
+	memories := map[int]*TileMemory{}
+	for depth, m := range e.Memories {
+		memories[depth] = m
+	}
+	if inv := e.inventory; inv != nil {
+		for _, item := range inv.Items {
+			si := savedItem(item)
+			si.Wielded = item == inv.Wielded
+			se.Inventory = append(se.Inventory, si)
+		}
+	}
+	e.mutex.Unlock()
+	for depth, m := range memories {
+		if se.Memories == nil {
+			se.Memories = map[int][]string{}
+		}
+		se.Memories[depth] = m.Rows()
+	}
+	return se
+}
+
+// LoadGame replaces the game state with the save in path and starts the
+// saved entities' AIs.
+func LoadGame(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var sf SaveFile
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return fmt.Errorf("%v: %v", path, err)
+	}
+	if sf.Version != saveVersion {
+		return fmt.Errorf("%v: save version %v, want %v", path, sf.Version, saveVersion)
+	}
+
+	var levels []*Level
+	var entities []*Entity
+	for _, sl := range sf.Levels {
+		l := &Level{Name: sl.Name, Depth: sl.Depth, Starts: sl.Starts, POIs: sl.POIs}
+		for _, row := range sl.Map {
+			l.Game = append(l.Game, []byte(row))
+		}
+		l.Scheduler.Turn = sl.Turn
+		for _, sfi := range sl.Items {
+			item, err := sfi.item()
+			if err != nil {
+				return fmt.Errorf("%v: level %v: %v", path, sl.Depth, err)
+			}
+			l.AddItem(sfi.X, sfi.Y, item)
+		}
+		for i, se := range sl.Entities {
+			e, err := loadEntity(se)
+			if err != nil {
+				return fmt.Errorf("%v: level %v: entity %v: %v", path, sl.Depth, i, err)
+			}
+			// The entity's on l, but isn't registered until its AI is
+			// started with the rest.
+			e.level = l
+			entities = append(entities, e)
+		}
+		levels = append(levels, l)
+	}
+	if len(levels) == 0 || levels[0].Depth != 0 {
+		return fmt.Errorf("%v: no top level", path)
+	}
+
+	messages := NewMessages()
+	for i, sm := range sf.Messages {
+		mes := Message{Text: sm.Text, Time: sm.Time, Turn: sm.Turn}
+		if sm.To < 0 || sm.To > len(entities) {
+			return fmt.Errorf("%v: message %v is for unknown entity %v", path, i, sm.To)
+		}
+		if sm.To > 0 {
+			mes.To = entities[sm.To-1]
+		}
+		messages.add(mes)
+	}
+	messages.turn = sf.Turn
+
+	GlobalRNG = RestoreRNG(sf.Seed, sf.RNGDraws)
+	GlobalMessages = messages
+	if world != nil {
+		world.Unload()
+	}
+	world = NewWorld(levels[0], sf.Seed)
+	world.Turn = sf.Turn
+	for _, l := range levels[1:] {
+		world.Add(l, l.Depth)
+	}
+	for _, e := range entities {
+		if name := e.AIName(); name != "" {
+			e.StartAI(name)
+		}
+		e.level.RegisterEntity(e)
+	}
+	return nil
+}
+
+// loadEntity rebuilds a saved entity, without starting its AI.
+func loadEntity(se SavedEntity) (*Entity, error) {
+	e := newEntity()
+	has := func(c ComponentSet) bool { return se.Components&c != 0 }
+	if has(PositionComponent) {
+		e.SetPosition(se.Position)
+	}
+	if has(HealthComponent) {
+		e.SetHealth(se.Health)
+	}
+	if has(StatsComponent) {
+		e.SetStats(se.Stats)
+	}
+	if has(RenderableComponent) {
+		symbol := []rune(se.Symbol)
+		if len(symbol) != 1 {
+			return nil, fmt.Errorf("bad symbol %q", se.Symbol)
+		}
+		e.SetRenderable(Renderable{symbol[0], se.Fg})
+	}
+	if has(AIComponent) {
+		if _, ok := AIs[se.AI]; !ok {
+			return nil, fmt.Errorf("unknown AI %q", se.AI)
+		}
+		e.ai = &AIController{Name: se.AI}
+	}
+	if has(InventoryComponent) {
+		e.inventory = &Inventory{}
+		for _, si := range se.Inventory {
+			item, err := si.item()
+			if err != nil {
+				return nil, err
+			}
+			e.inventory.Items = append(e.inventory.Items, item)
+			if si.Wielded {
+				e.inventory.Wielded = item
+			}
+		}
+	}
+	for depth, rows := range se.Memories {
+		if e.Memories == nil {
+			e.Memories = map[int]*TileMemory{}
+		}
+		e.Memories[depth] = TileMemoryFromRows(rows)
+	}
+	return e, nil
+}
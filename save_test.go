@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSaveGame_RoundTrip(t *testing.T) {
+	if err := LoadItemDefs(*itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	level, player := aiTestLevel(t, 1, 1)
+	defer func() { world.Unload() }()
+	rat := makeEntity(8, 3, 'r')
+	rat.StartAI("hunter")
+	level.RegisterEntity(rat)
+	for _, name := range []string{"dagger", "potion of healing"} {
+		item, err := NewItem(name, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		level.AddItem(1, 1, item)
+		player.Perform(Decision{"PickUp", 0})
+	}
+	player.Perform(Decision{"Wield", 0})
+	gold, _ := NewItem("gold piece", 7)
+	level.AddItem(5, 1, gold)
+	player.SetHealth(Health{HP: 6, MaxHP: 10})
+	player.LevelMemory(level).Remember(level, ComputeFOV(level, 1, 1, defaultSight))
+	GlobalMessages.Broadcast("Everyone hears this.")
+	GlobalMessages.Send(player, "Only the player hears this.")
+	for i := 0; i < 5; i++ {
+		GlobalRNG.Intn(100)
+	}
+
+	path := filepath.Join(t.TempDir(), "shogun.sav")
+	if err := SaveGame(path); err != nil {
+		t.Fatal(err)
+	}
+	var next []int
+	for i := 0; i < 5; i++ {
+		next = append(next, GlobalRNG.Intn(100))
+	}
+	wantEntities := []SavedEntity{saveEntity(player), saveEntity(rat)}
+	wantMemory := player.LevelMemory(level).Rows()
+	wantMessages := [][]string{messageTexts(player), messageTexts(rat)}
+
+	if err := LoadGame(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := world.Levels[0]
+	entities := loaded.ListEntities()
+	var gotEntities []SavedEntity
+	for _, e := range entities {
+		gotEntities = append(gotEntities, saveEntity(e))
+	}
+	if !reflect.DeepEqual(gotEntities, wantEntities) {
+		t.Errorf("loaded entities\n%+v\nwant\n%+v", gotEntities, wantEntities)
+	}
+	if got := entities[0].LevelMemory(loaded).Rows(); !reflect.DeepEqual(got, wantMemory) {
+		t.Errorf("loaded memory %q, want %q", got, wantMemory)
+	}
+	if pile := loaded.ItemsAt(5, 1); len(pile) != 1 || pile[0].String() != "7 gold pieces" {
+		t.Errorf("loaded %v on the floor, want 7 gold pieces", pile)
+	}
+	for i, e := range entities {
+		if got := messageTexts(e); !reflect.DeepEqual(got, wantMessages[i]) {
+			t.Errorf("entity %v has messages %q after loading, want %q", i, got, wantMessages[i])
+		}
+	}
+	for i, want := range next {
+		if got := GlobalRNG.Intn(100); got != want {
+			t.Errorf("random number %v after loading is %v, want %v", i, got, want)
+		}
+	}
+}
+
+// messageTexts returns the text of the messages e can read.
+func messageTexts(e *Entity) []string {
+	var texts []string
+	for _, mes := range GlobalMessages.For(e) {
+		texts = append(texts, mes.Text)
+	}
+	return texts
+}
+
+func TestLoadGame_OtherVersions(t *testing.T) {
+	// Version 0 is what a save without a version reads as; the next one
+	// is from a newer game than this.
+	for _, version := range []int{0, saveVersion + 1} {
+		data, err := json.Marshal(SaveFile{Version: version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "other.sav")
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadGame(path); err == nil {
+			t.Errorf("loaded a version %v save", version)
+		}
+	}
+}
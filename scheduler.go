@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// An entity spends actionCost energy per action and gains its Speed in
+// energy every game turn, so Speed 10 acts once a turn, 20 twice, and 5
+// every other turn.
+const (
+	actionCost   = 10
+	defaultSpeed = 10
+)
+
+// How long the scheduler waits on an AI before moving on without it.
+const turnTimeout = 100 * time.Millisecond
+
+/*
+ *  Scheduler struct and methods.
+ */
+
+// Scheduler hands out turns. Entities act one at a time in the order they
+// were registered, and each must finish its action before the next one
+// starts, so the same seed and input always produce the same game.
+type Scheduler struct {
+	// Game turns completed so far.
+	Turn  int
+	mutex sync.Mutex
+}
+
+// Tick advances the game by one turn: every entity gains energy and spends
+// it on as many actions as it can afford. Fast entities interleave their
+// extra actions with everyone else's rather than taking them all at once.
+// It returns the number of turns completed.
+func (s *Scheduler) Tick(entities []*Entity) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range entities {
+		e.UpdateStats(func(st *Stats) { st.Energy += st.Speed })
+	}
+	for acted := true; acted; {
+		acted = false
+		for _, e := range entities {
+			spent := false
+			e.UpdateStats(func(st *Stats) {
+				if st.Energy >= actionCost {
+					st.Energy -= actionCost
+					spent = true
+				}
+			})
+			if !spent {
+				continue
+			}
+			s.giveTurn(e)
+			acted = true
+		}
+	}
+	s.Turn++
+	return s.Turn
+}
+
+// giveTurn wakes e's AI and waits for it to finish acting. An AI that has
+// exited, or takes longer than turnTimeout, forfeits the turn: its token is
+// taken back, so whatever it decides afterwards is dropped rather than done
+// during someone else's turn.
+func (s *Scheduler) giveTurn(e *Entity) {
+	token := e.beginTurn()
+	defer e.endTurn()
+
+	timeout := time.NewTimer(turnTimeout)
+	defer timeout.Stop()
+	select {
+	case e.Tock <- token:
+	case <-e.aiExited:
+		return
+	case <-e.stop:
+		return
+	case <-timeout.C:
+		return
+	}
+	for !e.turnTaken(token) {
+		// turnDone may be left over from an earlier turn the AI finished
+		// late, so it only says to look again.
+		select {
+		case <-e.turnDone:
+		case <-e.aiExited:
+			return
+		case <-timeout.C:
+			return
+		}
+	}
+}
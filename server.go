@@ -0,0 +1,585 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var useTelnet = flag.Bool("telnet", true, "negotiate telnet options (character mode, window size) with players; turn off for raw TCP clients")
+var maxFPS = flag.Int("fps", 30, "most frames a second drawn for each client; 0 for no limit")
+var animateEvery = flag.Duration("animate", 250*time.Millisecond, "how often animated tiles like water change; 0 turns animation off")
+var autosaveEvery = flag.Duration("autosave", time.Minute, "how often logged in players' characters are saved, besides when they leave or change level; 0 turns it off")
+
+/*
+ *  Session struct and methods.
+ */
+
+// A Session is one terminal attached to the game, driving one player.
+type Session struct {
+	// What spectators know the player as.
+	Name   string
+	Client *termbox.TermClient
+	Player *Entity
+	// Most frames a second to draw; 0 means the -fps flag.
+	MaxFPS int
+	// The player's key bindings; nil means the -keys flag's.
+	Keys *KeyMap
+	// Where the session's being recorded, if it is; told when the terminal
+	// is resized.
+	Recorder *Recorder
+
+	// The inventory screen, while it's open: its title, and the predicate
+	// the chosen slot goes to, or "" if the player is only looking.
+	menuOpen   bool
+	menuTitle  string
+	menuAction string
+	// The message history viewer, while it's open, and how many lines back
+	// it's scrolled.
+	historyOpen   bool
+	historyScroll int
+	mutex         sync.Mutex
+
+	// Signalled when the screens above change and need drawing.
+	redraw chan struct{}
+}
+
+// inventoryCommands open the inventory screen, asking for a slot to use.
+var inventoryCommands = map[string]struct{ Title, Action string }{
+	"inventory": {"Inventory", ""},
+	"drop":      {"Drop what?", "Drop"},
+	"quaff":     {"Quaff what?", "Quaff"},
+	"wield":     {"Wield what?", "Wield"},
+}
+
+func (s *Session) openMenu(title, action string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.menuOpen, s.menuTitle, s.menuAction = true, title, action
+	s.markDirty()
+}
+
+// markDirty asks for a redraw, if one isn't already pending.
+func (s *Session) markDirty() {
+	select {
+	case s.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// closeMenu shuts the inventory screen and returns the predicate it was
+// choosing for.
+func (s *Session) closeMenu() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.menuOpen = false
+	s.markDirty()
+	return s.menuAction
+}
+
+func (s *Session) menu() (bool, string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.menuOpen, s.menuTitle
+}
+
+func (s *Session) toggleHistory() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.historyOpen = !s.historyOpen
+	s.historyScroll = 0
+	s.markDirty()
+}
+
+// scrollHistory moves the history viewer delta lines further back.
+func (s *Session) scrollHistory(delta int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	scroll := s.historyScroll + delta
+	if scroll < 0 {
+		scroll = 0
+	}
+	if scroll != s.historyScroll {
+		s.historyScroll = scroll
+		s.markDirty()
+	}
+}
+
+func (s *Session) history() (bool, int) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.historyOpen, s.historyScroll
+}
+
+// drawSession draws the game loop's latest frame: the history viewer if
+// it's open, otherwise the game with any inventory screen over it.
+func (s *Session) drawSession() {
+	tbox := s.Client
+	f, _ := gameLoop.Frame(s.Player.Level())
+	if f == nil {
+		// The player has just arrived on a new level, and its first frame
+		// isn't published yet. Publishing it will wake us again.
+		return
+	}
+	tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+	if open, scroll := s.history(); open {
+		clamped := drawHistory(tbox, f, s.Player, scroll)
+		s.scrollHistory(clamped - scroll)
+		return
+	}
+	drawGame(tbox, f, s.Player)
+	if open, title := s.menu(); open {
+		drawInventory(tbox, f, title, s.Player)
+	}
+}
+
+// act has the game loop run a game turn and then f, the player's action.
+// Dead players don't act.
+func (s *Session) act(f func()) {
+	gameLoop.Do(func() {
+		if s.Player.Dead() {
+			return
+		}
+		world.Tick()
+		f()
+	})
+}
+
+// climb takes the player up or down the stairs, saving their character
+// when they reach another level. Call it on the game loop.
+func (s *Session) climb(way int) {
+	from := s.Player.Level()
+	s.Player.Predicates["Climb"].Pick(way)
+	if s.Player.Level() != from {
+		keepCharacters([]*Session{s})
+	}
+}
+
+// handleHistoryKey scrolls the history viewer, or closes it on Esc or q.
+func (s *Session) handleHistoryKey(ev termbox.Event) {
+	_, h := s.Client.Size()
+	page := h - 2
+	switch {
+	case ev.Key == termbox.KeyArrowUp:
+		s.scrollHistory(1)
+	case ev.Key == termbox.KeyArrowDown:
+		s.scrollHistory(-1)
+	case ev.Key == termbox.KeyPgup:
+		s.scrollHistory(page)
+	case ev.Key == termbox.KeyPgdn:
+		s.scrollHistory(-page)
+	case ev.Key == termbox.KeyHome:
+		// drawHistory clamps this to the oldest message.
+		s.scrollHistory(maxMessages)
+	case ev.Key == termbox.KeyEnd:
+		s.scrollHistory(-maxMessages)
+	case ev.Key == termbox.KeyEsc, ev.Ch == 'q':
+		s.toggleHistory()
+	}
+}
+
+// drawLoop calls draw and flushes tbox whenever the game publishes a frame,
+// redraw is signalled, the terminal is resized or animated tiles are due to
+// change, but no faster than fps allows, 0 meaning the -fps flag. Resizes
+// are passed on to rec, if there is one. It returns a function that stops
+// it, waiting out any draw in progress.
+func drawLoop(tbox *termbox.TermClient, fps int, rec *Recorder, redraw <-chan struct{}, draw func()) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		var animate <-chan time.Time
+		if *animateEvery > 0 {
+			ticker := time.NewTicker(*animateEvery)
+			defer ticker.Stop()
+			animate = ticker.C
+		}
+		if fps == 0 {
+			fps = *maxFPS
+		}
+		var gap time.Duration
+		if fps > 0 {
+			gap = time.Second / time.Duration(fps)
+		}
+		for {
+			changed := gameLoop.Changed()
+			draw()
+			if err := tbox.Flush(); err != nil {
+				return
+			}
+			drawn := time.Now()
+
+			select {
+			case <-done:
+				return
+			case <-changed:
+			case <-redraw:
+			case <-animate:
+			case size := <-tbox.Win_chan:
+				if rec != nil {
+					rec.Resize(size.Cols, size.Rows)
+				}
+				// Put it back for Clear to apply, unless a newer size
+				// has already replaced it.
+				select {
+				case tbox.Win_chan <- size:
+				default:
+				}
+			}
+			// Anything else that changes while we wait is drawn along
+			// with this.
+			if wait := gap - time.Since(drawn); wait > 0 {
+				select {
+				case <-done:
+					return
+				case <-time.After(wait):
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// Run draws the level from the session player's point of view and sends
+// keystrokes to the game loop as the player's actions, until the player
+// hits Ctrl-C or the terminal goes away.
+func (s *Session) Run() {
+	tbox := s.Client
+	tbox.SetInputMode(termbox.InputEsc | termbox.InputMouse)
+	tbox.SetOutputMode(termbox.Output256)
+
+	// Draw whenever the game or the session's own screens change.
+	s.redraw = make(chan struct{}, 1)
+	// The caller closes the client once we return, so make sure nothing is
+	// still drawing into it.
+	defer drawLoop(tbox, s.MaxFPS, s.Recorder, s.redraw, s.drawSession)()
+
+	// Player Input Loop
+	keys := s.Keys
+	if keys == nil {
+		keys = keyMap
+	}
+	m, _ := s.Player.Predicates["Movement"]
+	for {
+		switch ev := tbox.PollEvent(); ev.Type {
+		case termbox.EventError:
+			return
+		case termbox.EventMouse:
+			if open, _ := s.history(); !open {
+				continue
+			}
+			if ev.Key == termbox.MouseWheelUp {
+				s.scrollHistory(3)
+			}
+			if ev.Key == termbox.MouseWheelDown {
+				s.scrollHistory(-3)
+			}
+		case termbox.EventKey:
+			if s.Player.Dead() {
+				return
+			}
+			cmd, _ := keys.Command(ev)
+			// Reading the history doesn't cost a turn either.
+			if cmd == "history" {
+				s.toggleHistory()
+				continue
+			}
+			if open, _ := s.history(); open {
+				s.handleHistoryKey(ev)
+				continue
+			}
+			// Looking through the inventory doesn't cost a turn; using
+			// something from it does. Any key but a slot letter closes it.
+			if open, _ := s.menu(); open {
+				action := s.closeMenu()
+				i := int(ev.Ch - 'a')
+				if action == "" || ev.Ch < 'a' || ev.Ch > 'z' || s.Player.InventoryItem(i) == nil {
+					continue
+				}
+				s.act(func() { s.Player.Predicates[action].Pick(i) })
+				continue
+			}
+			if k, ok := inventoryCommands[cmd]; ok {
+				s.openMenu(k.Title, k.Action)
+				continue
+			}
+			if dir, ok := moveCommands[cmd]; ok {
+				s.act(func() { m.Pick(dir) })
+				continue
+			}
+			switch cmd {
+			case "quit":
+				return
+			case "save":
+				// Saving doesn't cost a turn.
+				gameLoop.Do(func() {
+					if err := SaveGame(*savePath); err != nil {
+						GlobalMessages.Send(s.Player, fmt.Sprintf("Save failed: %v", err))
+					} else {
+						GlobalMessages.Broadcast(fmt.Sprintf("Game saved to %v.", *savePath))
+					}
+				})
+			case "pickup":
+				// Pick up the top of the pile.
+				s.act(func() {
+					pos, _ := s.Player.Position()
+					s.Player.Predicates["PickUp"].Pick(len(s.Player.Level().ItemsAt(pos.X, pos.Y)) - 1)
+				})
+			case "ascend":
+				s.act(func() { s.climb(ClimbUp) })
+			case "descend":
+				s.act(func() { s.climb(ClimbDown) })
+			}
+		}
+	}
+}
+
+// drawInventory draws viewer's inventory in f in a box over the top right
+// of the map.
+func drawInventory(tbox *termbox.TermClient, f *Frame, title string, viewer *Entity) {
+	v, _ := f.View(viewer)
+	lines := append([]string{title, ""}, v.Inventory...)
+	if len(lines) == 2 {
+		lines = append(lines, "You are empty handed.")
+	}
+	width := 0
+	for _, line := range lines {
+		if n := len([]rune(line)); n > width {
+			width = n
+		}
+	}
+	w, _ := tbox.Size()
+	left, top := w-width-4, 5
+	if left < 0 {
+		left = 0
+	}
+	for y := 0; y < len(lines)+2; y++ {
+		for x := 0; x < width+4; x++ {
+			tbox.SetCell(left+x, top+y, ' ', termbox.ColorWhite, termbox.ColorBlack)
+		}
+	}
+	for y, line := range lines {
+		for x, c := range []rune(line) {
+			tbox.SetCell(left+2+x, top+1+y, c, termbox.ColorWhite, termbox.ColorBlack)
+		}
+	}
+}
+
+/*
+ *  Network server.
+ */
+
+// Serve accepts players over TCP on addr. Every connection gets its own
+// TermClient, and a lobby where it can watch the others or join them with
+// its own player entity in the shared world.
+func Serve(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	log.Printf("shogun: listening on %v, random seed %v", ln.Addr(), GlobalRNG.Seed())
+	if accounts != nil && *autosaveEvery > 0 {
+		go autosave(*autosaveEvery)
+	}
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go servePlayer(conn)
+	}
+}
+
+// servePlayer runs one connection from the lobby, through any watching of
+// other players, to playing and disconnecting.
+func servePlayer(conn net.Conn) {
+	defer conn.Close()
+	log.Printf("shogun: %v connected", conn.RemoteAddr())
+	defer log.Printf("shogun: %v disconnected", conn.RemoteAddr())
+
+	tbox := termbox.NewClient()
+	var in io.Reader = conn
+	if *useTelnet {
+		tc := NewTelnetConn(conn)
+		tc.Sizes = tbox.Win_chan
+		if err := tc.Negotiate(); err != nil {
+			log.Printf("shogun: %v: %v", conn.RemoteAddr(), err)
+			return
+		}
+		in = tc
+	}
+	if err := tbox.InitRemote(in, conn, 80, 24); err != nil {
+		log.Printf("shogun: %v: %v", conn.RemoteAddr(), err)
+		return
+	}
+	// A session that can't be recorded is still played.
+	rec, err := recordSession(conn, 80, 24, conn.RemoteAddr().String())
+	if err != nil {
+		log.Printf("shogun: %v: %v", conn.RemoteAddr(), err)
+	} else if rec != nil {
+		tbox.Out = rec
+		defer func() {
+			if err := rec.Close(); err != nil {
+				log.Printf("shogun: %v: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+	defer tbox.Close()
+
+	// With accounts, players are who they log in as.
+	name := conn.RemoteAddr().String()
+	if accounts != nil {
+		if name = login(tbox, rec); name == "" {
+			return
+		}
+		defer accounts.Logout(name)
+		log.Printf("shogun: %v logged in as %v", conn.RemoteAddr(), name)
+	}
+
+	// Watch until they'd rather play or leave.
+	for {
+		choice, watch := lobby(tbox, rec)
+		if choice == LobbyLeave {
+			return
+		}
+		if choice == LobbyPlay {
+			break
+		}
+		spectator := &Spectator{Client: tbox, Recorder: rec}
+		spectator.Watch(watch)
+		spectator.Run()
+	}
+
+	var character *SavedCharacter
+	if accounts != nil {
+		character = accounts.Character(name)
+	}
+	player := joinPlayer(character)
+	if player == nil {
+		fmt.Fprintf(conn, "No room left on the level, try again later.\r\n")
+		return
+	}
+	// Keep the character for next time, or forget it if it died.
+	defer func() {
+		c, ok := leavePlayer(player)
+		if ok && accounts != nil {
+			if err := accounts.SetCharacter(name, c); err != nil {
+				log.Printf("shogun: %v: %v", conn.RemoteAddr(), err)
+			}
+		}
+	}()
+
+	session := &Session{Name: name, Client: tbox, Player: player, Recorder: rec}
+	gameLoop.Do(func() { roster.Add(session) })
+	defer gameLoop.Do(func() { roster.Remove(session) })
+	session.Run()
+}
+
+// joinPlayer puts a player in the world: c where it left off, as near as
+// there's room, or a new player on the top level if c is nil or can't be
+// put back. It returns nil if there's no room.
+func joinPlayer(c *SavedCharacter) *Entity {
+	var player *Entity
+	gameLoop.Do(func() {
+		if c != nil {
+			if player = resumeCharacter(c); player != nil {
+				return
+			}
+		}
+		top := world.Top()
+		x, y, ok := top.SpawnPoint()
+		if !ok {
+			return
+		}
+		player = makeEntity(x, y, '@')
+		player.StartAI("player")
+		top.RegisterEntity(player)
+		GlobalMessages.Broadcast("A new player has arrived.")
+		GlobalMessages.Send(player, fmt.Sprintf("Welcome to %v. Ctrl-P shows the message history.", top.Name))
+	})
+	return player
+}
+
+// resumeCharacter puts c back in the world, or returns nil if it can't. Call
+// it on the game loop.
+func resumeCharacter(c *SavedCharacter) *Entity {
+	player, err := loadEntity(c.Entity)
+	if err != nil {
+		log.Printf("shogun: can't resume a character: %v", err)
+		return nil
+	}
+	l, err := world.Level(c.Depth)
+	if err != nil {
+		log.Printf("shogun: can't resume a character: %v", err)
+		return nil
+	}
+	pos, _ := player.Position()
+	x, y, ok := l.OpenTileNear(pos.X, pos.Y)
+	if !ok {
+		return nil
+	}
+	player.SetPosition(Position{x, y})
+	player.StartAI("player")
+	l.RegisterEntity(player)
+	GlobalMessages.Broadcast("A player has returned.")
+	GlobalMessages.Send(player, fmt.Sprintf("Welcome back to %v.", l.Name))
+	return player
+}
+
+// leavePlayer takes player out of the world, returning it as a character
+// to resume later, or nil if it died. ok is false if the game loop has
+// stopped, and nothing was done.
+func leavePlayer(player *Entity) (c *SavedCharacter, ok bool) {
+	gameLoop.Do(func() {
+		c = characterOf(player)
+		player.Level().RemoveEntity(player)
+		GlobalMessages.Broadcast("A player has left.")
+		ok = true
+	})
+	return c, ok
+}
+
+// characterOf returns player as a character to resume later, or nil if
+// it's died. Call it on the game loop.
+func characterOf(player *Entity) *SavedCharacter {
+	if player.Dead() {
+		return nil
+	}
+	return &SavedCharacter{player.Level().Depth, saveEntity(player)}
+}
+
+// keepCharacters saves the players of sessions to their accounts as they
+// are now, so a crash doesn't lose their progress. Call it on the game loop,
+// so that it falls between turns, and can't overwrite the character kept by
+// a later leave or death.
+func keepCharacters(sessions []*Session) {
+	if accounts == nil || len(sessions) == 0 {
+		return
+	}
+	characters := map[string]*SavedCharacter{}
+	for _, s := range sessions {
+		characters[s.Name] = characterOf(s.Player)
+	}
+	if err := accounts.SetCharacters(characters); err != nil {
+		log.Printf("shogun: %v", err)
+	}
+}
+
+// autosave keeps everyone's characters every interval.
+func autosave(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		gameLoop.Do(func() { keepCharacters(roster.List()) })
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+/*
+ *  SpatialIndex struct and methods.
+ */
+
+// A SpatialIndex finds entities by position without scanning them all: a
+// grid the size of the level, each cell listing the entities standing on
+// it. It isn't safe for concurrent use; Level guards its index with the
+// level mutex.
+type SpatialIndex struct {
+	width, height int
+	cells         [][]*Entity
+}
+
+func NewSpatialIndex(width, height int) *SpatialIndex {
+	return &SpatialIndex{width, height, make([][]*Entity, width*height)}
+}
+
+func (s *SpatialIndex) cell(p Position) (int, bool) {
+	if p.X < 0 || p.Y < 0 || p.X >= s.width || p.Y >= s.height {
+		return 0, false
+	}
+	return p.Y*s.width + p.X, true
+}
+
+// Insert adds e at p. Positions off the grid aren't indexed.
+func (s *SpatialIndex) Insert(e *Entity, p Position) {
+	if i, ok := s.cell(p); ok {
+		s.cells[i] = append(s.cells[i], e)
+	}
+}
+
+// Remove takes e out of the cell at p.
+func (s *SpatialIndex) Remove(e *Entity, p Position) {
+	i, ok := s.cell(p)
+	if !ok {
+		return
+	}
+	for j, other := range s.cells[i] {
+		if other == e {
+			s.cells[i] = append(s.cells[i][:j], s.cells[i][j+1:]...)
+			break
+		}
+	}
+	if len(s.cells[i]) == 0 {
+		s.cells[i] = nil
+	}
+}
+
+func (s *SpatialIndex) Move(e *Entity, from, to Position) {
+	s.Remove(e, from)
+	s.Insert(e, to)
+}
+
+// At returns the entities at x, y, in the order they arrived.
+func (s *SpatialIndex) At(x, y int) []*Entity {
+	i, ok := s.cell(Position{x, y})
+	if !ok {
+		return nil
+	}
+	return append([]*Entity(nil), s.cells[i]...)
+}
+
+// InRect returns the entities in the width by height rectangle with its top
+// left corner at x, y, scanning rows top to bottom.
+func (s *SpatialIndex) InRect(x, y, width, height int) []*Entity {
+	var ret []*Entity
+	for row := max(y, 0); row < y+height && row < s.height; row++ {
+		for col := max(x, 0); col < x+width && col < s.width; col++ {
+			ret = append(ret, s.cells[row*s.width+col]...)
+		}
+	}
+	return ret
+}
+
+// Within returns the entities less than radius tiles from x, y, measured
+// the same way as field of view.
+func (s *SpatialIndex) Within(x, y, radius int) []*Entity {
+	var ret []*Entity
+	radius2 := radius * radius
+	for row := max(y-radius, 0); row <= y+radius && row < s.height; row++ {
+		for col := max(x-radius, 0); col <= x+radius && col < s.width; col++ {
+			dx, dy := col-x, row-y
+			if dx*dx+dy*dy < radius2 {
+				ret = append(ret, s.cells[row*s.width+col]...)
+			}
+		}
+	}
+	return ret
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+/*
+ *  Spatial queries on Level.
+ */
+
+// spatial returns the level's index, building it on first use. The caller
+// holds l.mutex.
+func (l *Level) spatial() *SpatialIndex {
+	if l.index == nil {
+		width := 0
+		if len(l.Game) > 0 {
+			width = len(l.Game[0])
+		}
+		l.index = NewSpatialIndex(width, len(l.Game))
+		for _, e := range l.Entities {
+			if p, ok := e.Position(); ok {
+				l.index.Insert(e, p)
+			}
+		}
+	}
+	return l.index
+}
+
+// GetEntity returns the entities at x, y.
+func (l *Level) GetEntity(x, y int) []*Entity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	ret := l.spatial().At(x, y)
+	if len(ret) == 0 {
+		return nil
+	}
+	return ret
+}
+
+// EntitiesInRect returns the entities in the width by height rectangle at
+// x, y, e.g. everything on screen.
+func (l *Level) EntitiesInRect(x, y, width, height int) []*Entity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.spatial().InRect(x, y, width, height)
+}
+
+// EntitiesWithin returns the entities less than radius tiles from x, y.
+func (l *Level) EntitiesWithin(x, y, radius int) []*Entity {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.spatial().Within(x, y, radius)
+}
+
+// MoveEntity moves e to x, y, unless another entity is already there. It
+// reports whether e moved. Entities on a level must move this way rather
+// than by SetPosition, to keep the index right.
+func (l *Level) MoveEntity(e *Entity, x, y int) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	index := l.spatial()
+	for _, other := range index.At(x, y) {
+		if other != e {
+			return false
+		}
+	}
+	to := Position{x, y}
+	from, ok := e.Position()
+	if ok {
+		index.Move(e, from, to)
+	} else {
+		index.Insert(e, to)
+	}
+	e.SetPosition(to)
+	return true
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSpatialIndex(t *testing.T) {
+	s := NewSpatialIndex(10, 5)
+	a, b, c := newEntity(), newEntity(), newEntity()
+	s.Insert(a, Position{2, 1})
+	s.Insert(b, Position{2, 1})
+	s.Insert(c, Position{8, 4})
+	// Off the grid, so not indexed.
+	s.Insert(newEntity(), Position{10, 0})
+	s.Insert(newEntity(), Position{-1, 2})
+
+	check := func(what string, got, want []*Entity) {
+		t.Helper()
+		if len(got) == 0 && len(want) == 0 {
+			return
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%v = %v, want %v", what, got, want)
+		}
+	}
+	check("At(2, 1)", s.At(2, 1), []*Entity{a, b})
+	check("At(3, 1)", s.At(3, 1), nil)
+	check("At(-1, 2)", s.At(-1, 2), nil)
+	check("InRect(0, 0, 10, 5)", s.InRect(0, 0, 10, 5), []*Entity{a, b, c})
+	check("InRect(-5, -5, 8, 7)", s.InRect(-5, -5, 8, 7), []*Entity{a, b})
+	check("InRect(3, 0, 5, 5)", s.InRect(3, 0, 5, 5), nil)
+	check("Within(8, 1, 4)", s.Within(8, 1, 4), []*Entity{c})
+	check("Within(8, 1, 3)", s.Within(8, 1, 3), nil)
+
+	s.Move(a, Position{2, 1}, Position{7, 4})
+	check("At(2, 1) after a moved", s.At(2, 1), []*Entity{b})
+	check("At(7, 4) after a moved", s.At(7, 4), []*Entity{a})
+	check("InRect(5, 3, 5, 2) after a moved", s.InRect(5, 3, 5, 2), []*Entity{a, c})
+
+	s.Remove(b, Position{2, 1})
+	s.Remove(c, Position{0, 0}) // not there, so nothing happens
+	check("At(2, 1) after b left", s.At(2, 1), nil)
+	check("InRect(0, 0, 10, 5) after b left", s.InRect(0, 0, 10, 5), []*Entity{a, c})
+
+	// What At returns is a copy.
+	s.At(7, 4)[0] = b
+	check("At(7, 4) after changing its result", s.At(7, 4), []*Entity{a})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+	"sync"
+)
+
+// The lobby lists this many players to watch, one per digit key; the rest
+// can be reached by switching from one of them.
+const lobbyListed = 9
+
+/*
+ *  Roster struct and methods.
+ */
+
+// The Roster is the sessions playing on the server, in the order they
+// joined, for spectators to choose from. It's changed on the game loop, so
+// that the frames published afterwards redraw anyone showing it.
+type Roster struct {
+	sessions []*Session
+	mutex    sync.Mutex
+}
+
+// The sessions playing on the server.
+var roster = &Roster{}
+
+func (r *Roster) Add(s *Session) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.sessions = append(r.sessions, s)
+}
+
+func (r *Roster) Remove(s *Session) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for i, other := range r.sessions {
+		if other == s {
+			r.sessions = append(r.sessions[:i], r.sessions[i+1:]...)
+			return
+		}
+	}
+}
+
+// List returns the sessions playing.
+func (r *Roster) List() []*Session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]*Session(nil), r.sessions...)
+}
+
+// Next returns the session delta places on from s, wrapping around, or the
+// first session if s isn't playing. It returns nil if nobody is.
+func (r *Roster) Next(s *Session, delta int) *Session {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	n := len(r.sessions)
+	if n == 0 {
+		return nil
+	}
+	for i, other := range r.sessions {
+		if other == s {
+			return r.sessions[((i+delta)%n+n)%n]
+		}
+	}
+	return r.sessions[0]
+}
+
+// Has reports whether s is playing.
+func (r *Roster) Has(s *Session) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, other := range r.sessions {
+		if other == s {
+			return true
+		}
+	}
+	return false
+}
+
+/*
+ *  The lobby.
+ */
+
+// What the lobby's user chose.
+const (
+	LobbyLeave = iota
+	LobbyPlay
+	LobbyWatch
+)
+
+// lobby lists who's playing on tbox and asks whether to play, watch one
+// of them, or leave. The session to watch is returned with LobbyWatch.
+func lobby(tbox *termbox.TermClient, rec *Recorder) (int, *Session) {
+	tbox.SetInputMode(termbox.InputEsc)
+	tbox.SetOutputMode(termbox.Output256)
+
+	// The sessions the digit keys pick, as last drawn.
+	var shown []*Session
+	var mutex sync.Mutex
+	draw := func() {
+		top := gameLoop.Top()
+		if top == nil {
+			return
+		}
+		tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+		drawString(tbox, 0, 0, fmt.Sprintf("Welcome to %v.", top.Name), termbox.ColorYellow)
+		drawString(tbox, 0, 2, "Enter  play", termbox.ColorWhite)
+		sessions := roster.List()
+		if len(sessions) > lobbyListed {
+			sessions = sessions[:lobbyListed]
+		}
+		if len(sessions) == 0 {
+			drawString(tbox, 0, 3, "       nobody is playing to watch", rememberedColor)
+		}
+		for i, s := range sessions {
+			drawString(tbox, 0, 3+i, lobbyLine(i, s), termbox.ColorWhite)
+		}
+		drawString(tbox, 0, 4+len(sessions), "q      leave", termbox.ColorWhite)
+		mutex.Lock()
+		shown = sessions
+		mutex.Unlock()
+	}
+	// The caller closes the client once we return, so make sure nothing is
+	// still drawing into it.
+	defer drawLoop(tbox, 0, rec, nil, draw)()
+
+	for {
+		ev := tbox.PollEvent()
+		switch {
+		case ev.Type == termbox.EventError:
+			return LobbyLeave, nil
+		case ev.Type != termbox.EventKey:
+		case ev.Key == termbox.KeyEnter:
+			return LobbyPlay, nil
+		case ev.Ch == 'q', ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlC:
+			return LobbyLeave, nil
+		case ev.Ch >= '1' && ev.Ch <= '9':
+			mutex.Lock()
+			i := int(ev.Ch - '1')
+			var s *Session
+			if i < len(shown) {
+				s = shown[i]
+			}
+			mutex.Unlock()
+			if s != nil {
+				return LobbyWatch, s
+			}
+		}
+	}
+}
+
+// lobbyLine describes the i'th session the lobby lists, as of its level's
+// latest frame, so that it's all from one turn. Someone who's just changed
+// level isn't on a frame yet.
+func lobbyLine(i int, s *Session) string {
+	if f, _ := gameLoop.Frame(s.Player.Level()); f != nil {
+		if v, ok := f.View(s.Player); ok {
+			return fmt.Sprintf("%v      watch %v, level %v, HP %v/%v", i+1, s.Name, f.Depth+1, v.Health.HP, v.Health.MaxHP)
+		}
+	}
+	return fmt.Sprintf("%v      watch %v, on the stairs", i+1, s.Name)
+}
+
+/*
+ *  Spectator struct and methods.
+ */
+
+// A Spectator watches somebody else's game: its client shows what the
+// watched player sees, and its keys only switch who to watch, or leave.
+// When the watched player leaves, it moves on to the next.
+type Spectator struct {
+	Client   *termbox.TermClient
+	Recorder *Recorder
+	// Most frames a second to draw; 0 means the -fps flag.
+	MaxFPS int
+
+	watching *Session
+	mutex    sync.Mutex
+	redraw   chan struct{}
+}
+
+// Watch switches to watching s.
+func (sp *Spectator) Watch(s *Session) {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	sp.watching = s
+	select {
+	case sp.redraw <- struct{}{}:
+	default:
+	}
+}
+
+// switchBy moves on delta sessions in the roster.
+func (sp *Spectator) switchBy(delta int) {
+	sp.Watch(roster.Next(sp.target(), delta))
+}
+
+// target returns the session being watched, moving on from one that's
+// left, or nil if nobody's playing.
+func (sp *Spectator) target() *Session {
+	sp.mutex.Lock()
+	defer sp.mutex.Unlock()
+	if !roster.Has(sp.watching) {
+		sp.watching = roster.Next(sp.watching, 1)
+	}
+	return sp.watching
+}
+
+func (sp *Spectator) draw() {
+	tbox := sp.Client
+	s := sp.target()
+	if s == nil {
+		tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+		drawString(tbox, 0, 0, "Nobody is playing now. Press q to leave.", termbox.ColorYellow)
+		return
+	}
+	f, _ := gameLoop.Frame(s.Player.Level())
+	if f == nil {
+		// As in drawSession: they've just arrived on a new level, and
+		// publishing its first frame will wake us again.
+		return
+	}
+	tbox.Clear(termbox.ColorBlack, termbox.ColorBlack)
+	drawGame(tbox, f, s.Player)
+	// Over the right of the stats line.
+	banner := fmt.Sprintf(" Watching %v. Tab: next, q: leave ", s.Name)
+	w, h := tbox.Size()
+	x := w - len([]rune(banner))
+	if x < 0 {
+		x = 0
+	}
+	for i, c := range []rune(banner) {
+		tbox.SetCell(x+i, h-1, c, termbox.ColorBlack, termbox.ColorYellow)
+	}
+}
+
+// Run draws the watched player's game until the spectator leaves or the
+// terminal goes away.
+func (sp *Spectator) Run() {
+	tbox := sp.Client
+	tbox.SetInputMode(termbox.InputEsc)
+	tbox.SetOutputMode(termbox.Output256)
+
+	sp.redraw = make(chan struct{}, 1)
+	// The caller closes the client once we return, so make sure nothing is
+	// still drawing into it.
+	defer drawLoop(tbox, sp.MaxFPS, sp.Recorder, sp.redraw, sp.draw)()
+
+	for {
+		ev := tbox.PollEvent()
+		switch {
+		case ev.Type == termbox.EventError:
+			return
+		case ev.Type != termbox.EventKey:
+		case ev.Ch == 'q', ev.Key == termbox.KeyEsc, ev.Key == termbox.KeyCtrlC:
+			return
+		case ev.Key == termbox.KeyTab, ev.Key == termbox.KeyArrowRight, ev.Ch == 'n':
+			sp.switchBy(1)
+		case ev.Key == termbox.KeyArrowLeft, ev.Ch == 'p':
+			sp.switchBy(-1)
+		}
+	}
+}
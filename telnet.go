@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/binary"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io"
+	"sync"
+)
+
+// Telnet commands and options, RFC 854 and friends.
+const (
+	telnetSE   = 240
+	telnetSB   = 250
+	telnetWILL = 251
+	telnetWONT = 252
+	telnetDO   = 253
+	telnetDONT = 254
+	telnetIAC  = 255
+
+	telnetOptEcho = 1  // RFC 857
+	telnetOptSGA  = 3  // RFC 858, suppress go ahead
+	telnetOptNAWS = 31 // RFC 1073, negotiate about window size
+)
+
+// States for the input parser.
+const (
+	telnetStateData = iota
+	telnetStateIAC
+	telnetStateOption // saw IAC WILL/WONT/DO/DONT, option byte next
+	telnetStateSB
+	telnetStateSBIAC
+	telnetStateCR
+)
+
+// TelnetConn sits between a player's socket and their TermClient. It
+// strips telnet commands out of the input stream so PollEvent only ever
+// sees keystrokes, answers option negotiation, and turns NAWS reports into
+// Winsize values on the client's Win_chan.
+type TelnetConn struct {
+	r io.Reader
+	w io.Writer
+	// Where window sizes from NAWS go; usually a TermClient's Win_chan.
+	Sizes chan termbox.Winsize
+
+	state int
+	verb  byte
+	sb    []byte
+	// Options we've agreed to perform (WILL) and asked the client to
+	// perform (DO), so we only answer requests that change something and
+	// never loop.
+	will   map[byte]bool
+	do     map[byte]bool
+	wmutex sync.Mutex
+}
+
+func NewTelnetConn(rw io.ReadWriter) *TelnetConn {
+	return &TelnetConn{
+		r:    rw,
+		w:    rw,
+		will: map[byte]bool{},
+		do:   map[byte]bool{},
+	}
+}
+
+// Negotiate puts the client's terminal into character mode: we echo and
+// suppress go-aheads, so it stops line buffering and local echo, and we
+// ask it to report its window size.
+func (t *TelnetConn) Negotiate() error {
+	t.wmutex.Lock()
+	defer t.wmutex.Unlock()
+	t.will[telnetOptEcho] = true
+	t.will[telnetOptSGA] = true
+	t.do[telnetOptSGA] = true
+	t.do[telnetOptNAWS] = true
+	_, err := t.w.Write([]byte{
+		telnetIAC, telnetWILL, telnetOptEcho,
+		telnetIAC, telnetWILL, telnetOptSGA,
+		telnetIAC, telnetDO, telnetOptSGA,
+		telnetIAC, telnetDO, telnetOptNAWS,
+	})
+	return err
+}
+
+// Read returns the player's keystrokes with all telnet commands removed.
+// It only returns with zero bytes and no error if the underlying reader
+// does.
+func (t *TelnetConn) Read(b []byte) (int, error) {
+	raw := make([]byte, len(b))
+	for {
+		n, err := t.r.Read(raw)
+		out := 0
+		for _, c := range raw[:n] {
+			if t.feed(c) {
+				b[out] = c
+				out++
+			}
+		}
+		// Don't hand PollEvent an empty read just because a packet held
+		// nothing but negotiation.
+		if out > 0 || err != nil || n == 0 {
+			return out, err
+		}
+	}
+}
+
+// feed advances the parser by one byte and reports whether the byte is
+// player input.
+func (t *TelnetConn) feed(c byte) bool {
+	switch t.state {
+	case telnetStateData:
+		switch c {
+		case telnetIAC:
+			t.state = telnetStateIAC
+			return false
+		case '\r':
+			// Clients send Enter as CR NUL or CR LF; keep only the CR.
+			t.state = telnetStateCR
+		}
+		return true
+	case telnetStateCR:
+		t.state = telnetStateData
+		if c == 0 || c == '\n' {
+			return false
+		}
+		return t.feed(c)
+	case telnetStateIAC:
+		switch c {
+		case telnetIAC:
+			// Escaped 0xFF data byte.
+			t.state = telnetStateData
+			return true
+		case telnetWILL, telnetWONT, telnetDO, telnetDONT:
+			t.verb = c
+			t.state = telnetStateOption
+		case telnetSB:
+			t.sb = t.sb[:0]
+			t.state = telnetStateSB
+		default:
+			// NOP, go ahead, break, and the rest carry no data for us.
+			t.state = telnetStateData
+		}
+	case telnetStateOption:
+		t.answer(t.verb, c)
+		t.state = telnetStateData
+	case telnetStateSB:
+		if c == telnetIAC {
+			t.state = telnetStateSBIAC
+		} else {
+			t.sb = append(t.sb, c)
+		}
+	case telnetStateSBIAC:
+		switch c {
+		case telnetSE:
+			t.subnegotiation(t.sb)
+			t.state = telnetStateData
+		case telnetIAC:
+			t.sb = append(t.sb, telnetIAC)
+			t.state = telnetStateSB
+		default:
+			// Malformed; drop the subnegotiation.
+			t.state = telnetStateData
+		}
+	}
+	return false
+}
+
+// answer responds to the client's side of an option negotiation.
+func (t *TelnetConn) answer(verb, opt byte) {
+	t.wmutex.Lock()
+	defer t.wmutex.Unlock()
+	var reply byte
+	switch verb {
+	case telnetDO:
+		if opt != telnetOptEcho && opt != telnetOptSGA {
+			reply = telnetWONT
+			break
+		}
+		if t.will[opt] {
+			return // Acknowledgement of what we already do.
+		}
+		t.will[opt] = true
+		reply = telnetWILL
+	case telnetDONT:
+		if !t.will[opt] {
+			return
+		}
+		t.will[opt] = false
+		reply = telnetWONT
+	case telnetWILL:
+		if opt != telnetOptSGA && opt != telnetOptNAWS {
+			reply = telnetDONT
+			break
+		}
+		if t.do[opt] {
+			return
+		}
+		t.do[opt] = true
+		reply = telnetDO
+	case telnetWONT:
+		if !t.do[opt] {
+			return
+		}
+		t.do[opt] = false
+		reply = telnetDONT
+	}
+	t.w.Write([]byte{telnetIAC, reply, opt})
+}
+
+// subnegotiation handles IAC SB ... IAC SE payloads. Only NAWS is
+// interesting: option, then width and height as big-endian uint16s.
+func (t *TelnetConn) subnegotiation(sb []byte) {
+	if len(sb) != 5 || sb[0] != telnetOptNAWS || t.Sizes == nil {
+		return
+	}
+	size := termbox.Winsize{
+		Cols: int(binary.BigEndian.Uint16(sb[1:3])),
+		Rows: int(binary.BigEndian.Uint16(sb[3:5])),
+	}
+	if size.Cols == 0 || size.Rows == 0 {
+		return // Client doesn't know its size.
+	}
+	// Only the latest size matters; replace one the renderer hasn't
+	// picked up yet rather than blocking input on it.
+	for {
+		select {
+		case t.Sizes <- size:
+			return
+		default:
+		}
+		select {
+		case <-t.Sizes:
+		default:
+		}
+	}
+}
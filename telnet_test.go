@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"github.com/sillsm/pseudo-termbox-go"
+	"io/ioutil"
+	"testing"
+)
+
+// telnetPipe is a connection whose input is fixed and whose output is kept.
+type telnetPipe struct {
+	in  *bytes.Reader
+	out bytes.Buffer
+}
+
+func (p *telnetPipe) Read(b []byte) (int, error) {
+	return p.in.Read(b)
+}
+
+func (p *telnetPipe) Write(b []byte) (int, error) {
+	return p.out.Write(b)
+}
+
+func TestTelnetConn(t *testing.T) {
+	const (
+		IAC  = telnetIAC
+		SB   = telnetSB
+		SE   = telnetSE
+		WILL = telnetWILL
+		WONT = telnetWONT
+		DO   = telnetDO
+		DONT = telnetDONT
+		ECHO = telnetOptEcho
+		SGA  = telnetOptSGA
+		NAWS = telnetOptNAWS
+	)
+	for _, test := range []struct {
+		name string
+		in   []byte
+		// The player's input left after the commands are taken out, and
+		// what's sent back after Negotiate's requests.
+		keys    string
+		replies []byte
+		// The last window size reported, if any.
+		size *termbox.Winsize
+	}{
+		{name: "plain", in: []byte("hjkl"), keys: "hjkl"},
+		{name: "escaped IAC", in: []byte{'a', IAC, IAC, 'b'}, keys: "a\xffb"},
+		{name: "CR NUL", in: []byte{'a', '\r', 0, 'b'}, keys: "a\rb"},
+		{name: "CR LF", in: []byte{'a', '\r', '\n', 'b'}, keys: "a\rb"},
+		{name: "CR then a key", in: []byte{'\r', 'x', '\r'}, keys: "\rx\r"},
+		{name: "NOP", in: []byte{'a', IAC, 241, 'b'}, keys: "ab"},
+		{
+			name: "NAWS",
+			in:   []byte{IAC, SB, NAWS, 0, 100, 0, 30, IAC, SE, 'a'},
+			keys: "a",
+			size: &termbox.Winsize{Cols: 100, Rows: 30},
+		},
+		{
+			name: "NAWS with an escaped 255",
+			in:   []byte{IAC, SB, NAWS, 0, IAC, IAC, 0, 40, IAC, SE},
+			size: &termbox.Winsize{Cols: 255, Rows: 40},
+		},
+		{
+			name: "latest NAWS wins",
+			in:   []byte{IAC, SB, NAWS, 0, 80, 0, 24, IAC, SE, IAC, SB, NAWS, 0, 90, 0, 25, IAC, SE},
+			size: &termbox.Winsize{Cols: 90, Rows: 25},
+		},
+		{name: "unknown size", in: []byte{IAC, SB, NAWS, 0, 0, 0, 0, IAC, SE}},
+		{name: "short NAWS", in: []byte{IAC, SB, NAWS, 0, 80, IAC, SE, 'a'}, keys: "a"},
+		{name: "malformed subnegotiation", in: []byte{IAC, SB, NAWS, 0, IAC, 'x', 'a'}, keys: "a"},
+		// Agreeing to what we asked for, or already do, mustn't be
+		// answered, or the two sides would go back and forth forever.
+		{name: "acknowledgements", in: []byte{IAC, DO, ECHO, IAC, DO, SGA, IAC, WILL, SGA, IAC, WILL, NAWS}},
+		{name: "refused", in: []byte{IAC, DO, 24, IAC, WILL, 24}, replies: []byte{IAC, WONT, 24, IAC, DONT, 24}},
+		{
+			name:    "turned off once",
+			in:      []byte{IAC, DONT, ECHO, IAC, DONT, ECHO, IAC, WONT, NAWS, IAC, WONT, NAWS},
+			replies: []byte{IAC, WONT, ECHO, IAC, DONT, NAWS},
+		},
+		{
+			name:    "turned back on",
+			in:      []byte{IAC, DONT, ECHO, IAC, DO, ECHO, IAC, DO, ECHO},
+			replies: []byte{IAC, WONT, ECHO, IAC, WILL, ECHO},
+		},
+	} {
+		pipe := &telnetPipe{in: bytes.NewReader(test.in)}
+		conn := NewTelnetConn(pipe)
+		conn.Sizes = make(chan termbox.Winsize, 1)
+		if err := conn.Negotiate(); err != nil {
+			t.Fatal(err)
+		}
+		requests := pipe.out.Len()
+		keys, err := ioutil.ReadAll(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(keys) != test.keys {
+			t.Errorf("%v: read %q, want %q", test.name, keys, test.keys)
+		}
+		if replies := pipe.out.Bytes()[requests:]; !bytes.Equal(replies, test.replies) {
+			t.Errorf("%v: replied %v, want %v", test.name, replies, test.replies)
+		}
+		var size *termbox.Winsize
+		select {
+		case s := <-conn.Sizes:
+			size = &s
+		default:
+		}
+		if (size == nil) != (test.size == nil) || size != nil && *size != *test.size {
+			t.Errorf("%v: window size %v, want %v", test.name, size, test.size)
+		}
+	}
+}
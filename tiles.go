@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"github.com/sillsm/pseudo-termbox-go"
+)
+
+/*
+ *  Tile struct and registry.
+ */
+
+// A Tile describes one kind of terrain: how it can be crossed, whether it
+// can be seen through, and how it's drawn.
+type Tile struct {
+	Name  string
+	Glyph byte
+	// Whether anyone can step onto the tile, or only entities that swim.
+	Walkable  bool
+	Swimmable bool
+	// Whether the tile blocks line of sight.
+	Opaque bool
+	Fg, Bg termbox.Attribute
+	// If set, one draw in AnimOdds shows one of Frames instead of the
+	// glyph, e.g. waves on water.
+	Frames   []rune
+	AnimOdds int
+}
+
+// Tiles holds every known tile, keyed by glyph. Levels store glyphs, so
+// this is how the engine finds out what a map square is.
+var Tiles = map[byte]*Tile{}
+
+// RegisterTile adds t to Tiles. It panics on a reused glyph or name, since
+// that's always a programming error.
+func RegisterTile(t Tile) {
+	if _, ok := Tiles[t.Glyph]; ok {
+		panic(fmt.Errorf("Registered tile glyph twice: %q", t.Glyph))
+	}
+	if _, ok := TileNamed(t.Name); ok {
+		panic(fmt.Errorf("Registered tile name twice: %v", t.Name))
+	}
+	Tiles[t.Glyph] = &t
+}
+
+// TileNamed looks a tile up by name, as used in level file legends.
+func TileNamed(name string) (*Tile, bool) {
+	for _, t := range Tiles {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+func init() {
+	RegisterTile(Tile{Name: "floor", Glyph: '.', Walkable: true,
+		Fg: termbox.ColorWhite, Bg: termbox.ColorBlack})
+	RegisterTile(Tile{Name: "wall", Glyph: '#', Opaque: true,
+		Fg: termbox.ColorWhite, Bg: termbox.ColorBlack})
+	RegisterTile(Tile{Name: "water", Glyph: '~', Swimmable: true,
+		Fg: termbox.ColorBlue, Bg: termbox.ColorBlack,
+		Frames: []rune{'≈'}, AnimOdds: 10})
+	RegisterTile(Tile{Name: "shore", Glyph: '/', Walkable: true,
+		Fg: termbox.ColorYellow, Bg: termbox.ColorBlack})
+	RegisterTile(Tile{Name: "pier", Glyph: '|',
+		Fg: termbox.ColorYellow, Bg: termbox.ColorBlack})
+	RegisterTile(Tile{Name: "stairs up", Glyph: StairsUp, Walkable: true,
+		Fg: termbox.ColorWhite | termbox.AttrBold, Bg: termbox.ColorBlack})
+	RegisterTile(Tile{Name: "stairs down", Glyph: StairsDown, Walkable: true,
+		Fg: termbox.ColorWhite | termbox.AttrBold, Bg: termbox.ColorBlack})
+}
+
+// Passable reports whether e may stand on the tile.
+func (t *Tile) Passable(e *Entity) bool {
+	stats, _ := e.Stats()
+	return t.Walkable || t.Swimmable && stats.Swim > 0
+}
+
+// Rune is what to draw for the tile at x, y on the given animation frame.
+func (t *Tile) Rune(x, y, frame int) rune {
+	if len(t.Frames) > 0 && GlobalRNG.Noise(t.AnimOdds, x, y, frame) == 0 {
+		return t.Frames[GlobalRNG.Noise(len(t.Frames), y, x, frame)]
+	}
+	return rune(t.Glyph)
+}
@@ -0,0 +1,63 @@
+package main
+
+/*
+ *  Viewport struct and methods.
+ */
+
+// A Viewport is the window of a level that fits on a player's screen. It
+// follows the player, but stops at the map's edges rather than showing
+// empty space past them.
+type Viewport struct {
+	// Map coordinates of the top left visible tile.
+	X, Y int
+	// Screen position the top left tile is drawn at.
+	ScreenX, ScreenY int
+	// Size of the window, in tiles.
+	Width, Height int
+}
+
+// NewViewport centers a width by height window on (cx, cy) in l, to be
+// drawn with its top left corner at (screenX, screenY).
+func NewViewport(l *Level, cx, cy, screenX, screenY, width, height int) Viewport {
+	mapW, mapH := 0, len(l.Game)
+	if mapH > 0 {
+		mapW = len(l.Game[0])
+	}
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+	return Viewport{
+		X:       clampOrigin(cx-width/2, width, mapW),
+		Y:       clampOrigin(cy-height/2, height, mapH),
+		ScreenX: screenX,
+		ScreenY: screenY,
+		Width:   width,
+		Height:  height,
+	}
+}
+
+// clampOrigin keeps a window of size span inside [0, size). A map smaller
+// than the window is pinned to its start.
+func clampOrigin(origin, span, size int) int {
+	if origin > size-span {
+		origin = size - span
+	}
+	if origin < 0 {
+		origin = 0
+	}
+	return origin
+}
+
+// Contains reports whether map position (x, y) is in view.
+func (v Viewport) Contains(x, y int) bool {
+	return x >= v.X && x < v.X+v.Width && y >= v.Y && y < v.Y+v.Height
+}
+
+// ToScreen translates a map position to a screen cell, and ok if it's in
+// view.
+func (v Viewport) ToScreen(x, y int) (int, int, bool) {
+	return x - v.X + v.ScreenX, y - v.Y + v.ScreenY, v.Contains(x, y)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+var maxDepth = flag.Int("depth", 8, "how many levels deep the dungeon goes")
+var tickRadius = flag.Int("tickradius", 0, "levels this many above or below a player keep running; 0 runs only the levels players are on")
+
+// The generators levels below the top take turns with, see package
+// generate, unless -generate picks one for every level.
+var deeperGenerators = []string{"bsp", "caves"}
+
+// Climb's options.
+const (
+	ClimbUp = iota + 1
+	ClimbDown
+)
+
+/*
+ *  World struct and methods.
+ */
+
+// The World is the whole dungeon: a stack of levels joined by stairs, the
+// top at depth 0. Levels below the top are built the first time anyone
+// goes down to them. Like the levels, it's only changed on the game loop.
+type World struct {
+	// The levels built so far, by depth.
+	Levels map[int]*Level
+	// Game turns completed.
+	Turn int
+	// Levels below the top are generated from Seed plus their depth.
+	Seed int64
+}
+
+// NewWorld starts a world with top as its first level.
+func NewWorld(top *Level, seed int64) *World {
+	w := &World{Levels: map[int]*Level{}, Seed: seed}
+	w.Add(top, 0)
+	return w
+}
+
+// Add puts l in the world at depth.
+func (w *World) Add(l *Level, depth int) {
+	l.Depth = depth
+	w.Levels[depth] = l
+}
+
+// Top is the level players join on.
+func (w *World) Top() *Level {
+	return w.Levels[0]
+}
+
+// Depths returns the depths of the levels built so far, top first.
+func (w *World) Depths() []int {
+	var depths []int
+	for d := range w.Levels {
+		depths = append(depths, d)
+	}
+	sort.Ints(depths)
+	return depths
+}
+
+// Level returns the level at depth, building it if nobody's been there.
+// A level file named after the -map level and the depth, such as
+// harbor-1.des, is loaded if there is one; otherwise the level is
+// generated, with stairs up and, unless it's the bottom, down. With
+// -generate set, every level is generated, by the generator it names.
+func (w *World) Level(depth int) (*Level, error) {
+	if l, ok := w.Levels[depth]; ok {
+		return l, nil
+	}
+	if depth <= 0 || depth >= *maxDepth {
+		return nil, fmt.Errorf("there is no level %v", depth)
+	}
+	var mf *MapFile
+	var err error
+	path := strings.TrimSuffix(MapPath(*mapName), ".des") + fmt.Sprintf("-%v.des", depth)
+	if _, statErr := os.Stat(path); *generator == "" && statErr == nil {
+		mf, err = LoadMapFile(path)
+	} else {
+		stairs := []byte{StairsUp}
+		if depth < *maxDepth-1 {
+			stairs = append(stairs, StairsDown)
+		}
+		var width, height int
+		if width, height, err = generatedSize(); err == nil {
+			name := *generator
+			if name == "" {
+				name = deeperGenerators[(depth-1)%len(deeperGenerators)]
+			}
+			mf, err = GenerateMapFile(name, width, height, w.Seed+int64(depth), stairs...)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	l, err := mf.NewLevel()
+	if err != nil {
+		return nil, err
+	}
+	w.Add(l, depth)
+	return l, nil
+}
+
+// Players returns the players on every level.
+func (w *World) Players() []*Entity {
+	var players []*Entity
+	for _, d := range w.Depths() {
+		for _, e := range w.Levels[d].ListEntities() {
+			if e.AIName() == "player" {
+				players = append(players, e)
+			}
+		}
+	}
+	return players
+}
+
+// Tick runs one game turn on every level within -tickradius of a player,
+// top first. The rest of the dungeon waits for someone to come near.
+func (w *World) Tick() {
+	active := map[int]bool{}
+	for _, p := range w.Players() {
+		for d := p.Level().Depth - *tickRadius; d <= p.Level().Depth+*tickRadius; d++ {
+			active[d] = true
+		}
+	}
+	for _, d := range w.Depths() {
+		if active[d] {
+			w.Levels[d].Tick()
+		}
+	}
+	w.Turn++
+	GlobalMessages.SetTurn(w.Turn)
+}
+
+// Move takes e off its level and puts it on to at x, y, AI still running.
+func (w *World) Move(e *Entity, to *Level, x, y int) {
+	if from := e.Level(); from != nil {
+		from.unregister(e)
+	}
+	e.SetPosition(Position{x, y})
+	to.RegisterEntity(e)
+}
+
+// Unload unloads every level.
+func (w *World) Unload() {
+	for _, l := range w.Levels {
+		l.Unload()
+	}
+}
+
+// The world being played.
+var world *World
+
+/*
+ *  Stairs.
+ */
+
+// The stair glyphs.
+const (
+	StairsUp   = '<'
+	StairsDown = '>'
+)
+
+// Stairs returns where the glyph c is on the level, and ok if it's there.
+func (l *Level) Stairs(c byte) (Point, bool) {
+	for y, row := range l.Game {
+		for x, g := range row {
+			if g == c {
+				return Point{x, y}, true
+			}
+		}
+	}
+	return Point{}, false
+}
+
+// Climb takes the entity up or down the stairs it's standing on, to the
+// other end of them on the next level.
+func Climb(e *Entity) func(int) {
+	return func(i int) {
+		from := e.Level()
+		pos, ok := e.Position()
+		if from == nil || !ok {
+			return
+		}
+		t, _ := from.GetTile(pos.X, pos.Y)
+		depth, arrive, way := from.Depth, byte(StairsDown), "up"
+		switch {
+		case i == ClimbUp && t == StairsUp:
+			depth--
+		case i == ClimbDown && t == StairsDown:
+			depth, arrive, way = depth+1, StairsUp, "down"
+		default:
+			GlobalMessages.Send(e, "You can't go that way here.")
+			return
+		}
+		to, err := world.Level(depth)
+		if err != nil {
+			GlobalMessages.Send(e, fmt.Sprintf("The stairs are blocked: %v.", err))
+			return
+		}
+		p, ok := to.Stairs(arrive)
+		if !ok && len(to.Starts) > 0 {
+			p = to.Starts[0]
+		}
+		x, y, ok := to.OpenTileNear(p.X, p.Y)
+		if !ok {
+			GlobalMessages.Send(e, "There's no room on the stairs.")
+			return
+		}
+		GlobalMessages.Broadcast(fmt.Sprintf("%v goes %v the stairs.", e.Name(), way))
+		world.Move(e, to, x, y)
+		GlobalMessages.Send(e, fmt.Sprintf("You arrive in %v.", to.Name))
+	}
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"github.com/sillsm/pseudo-termbox-go"
+	"strings"
+	"testing"
+)
+
+const worldTestMap = `
+MAP
+##########
+#.>......#
+#........#
+##########
+ENDMAP
+START: (1,1)
+`
+
+func TestWorld_Stairs(t *testing.T) {
+	mf, err := ParseMapFile(strings.NewReader(worldTestMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := mf.NewLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	world = NewWorld(top, 1)
+	defer world.Unload()
+	GlobalRNG = NewRNG(1)
+	GlobalMessages = NewMessages()
+	player := makeEntity(2, 1, '@')
+	player.StartAI("player")
+	top.RegisterEntity(player)
+
+	// Nobody's been below, so the top is all there is and all that runs.
+	ai := &stopAI{}
+	RegisterAI("test-stop", func() AI { return ai })
+	defer delete(AIs, "test-stop")
+	e := makeEntity(8, 2, 'x')
+	e.StartAI("test-stop")
+	top.RegisterEntity(e)
+	if len(world.Levels) != 1 {
+		t.Fatalf("world has %v levels before anyone went down, want 1", len(world.Levels))
+	}
+	world.Tick()
+
+	player.Perform(Decision{"Climb", ClimbDown})
+	below := player.Level()
+	if below == top || below.Depth != 1 {
+		t.Fatalf("player on depth %v after going down, want 1", below.Depth)
+	}
+	stairs, ok := below.Stairs(StairsUp)
+	if !ok {
+		t.Fatalf("level 1 has no stairs up")
+	}
+	if p, _ := player.Position(); p != (Position{stairs.X, stairs.Y}) {
+		t.Errorf("player at %v, want on the stairs up at %v", p, stairs)
+	}
+	if top.GetEntity(2, 1) != nil {
+		t.Errorf("player still on the top level")
+	}
+
+	// With no players left on the top, it waits.
+	world.Tick()
+	if ai.turns != 1 {
+		t.Errorf("top level monster had %v turns, want 1", ai.turns)
+	}
+
+	player.Perform(Decision{"Climb", ClimbUp})
+	if player.Level() != top {
+		t.Fatalf("player on depth %v after going up, want 0", player.Level().Depth)
+	}
+	if p, _ := player.Position(); p != (Position{2, 1}) {
+		t.Errorf("player at %v, want on the stairs down at (2,1)", p)
+	}
+}
+
+// A player who's just gone down to a new level has no frame to draw until
+// the next publish; drawing them must wait for it rather than crash.
+func TestWorld_DrawBeforePublish(t *testing.T) {
+	mf, err := ParseMapFile(strings.NewReader(worldTestMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := mf.NewLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	world = NewWorld(top, 1)
+	defer world.Unload()
+	GlobalRNG = NewRNG(1)
+	GlobalMessages = NewMessages()
+	player := makeEntity(2, 1, '@')
+	player.StartAI("player")
+	top.RegisterEntity(player)
+
+	gameLoop = NewGameLoop()
+	gameLoop.publish()
+	if f := gameLoop.Top(); f == nil || f.Name != top.Name {
+		t.Errorf("top frame is %+v, want one of %v", f, top.Name)
+	}
+	player.Perform(Decision{"Climb", ClimbDown})
+	if f, _ := gameLoop.Frame(player.Level()); f != nil {
+		t.Fatalf("level 1 has a frame before it was published")
+	}
+	tbox := termbox.NewVirtualClient(80, 24)
+	defer tbox.Close()
+	session := &Session{Client: tbox, Player: player}
+	session.drawSession()
+
+	// Nor may anyone watching them.
+	roster.Add(session)
+	defer roster.Remove(session)
+	spectator := &Spectator{Client: tbox}
+	spectator.Watch(session)
+	spectator.draw()
+}
+
+// The lobby describes players as of their level's latest frame, not as they
+// are while the game loop is changing them.
+func TestLobbyLine(t *testing.T) {
+	mf, err := ParseMapFile(strings.NewReader(worldTestMap))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := mf.NewLevel()
+	if err != nil {
+		t.Fatal(err)
+	}
+	world = NewWorld(top, 1)
+	defer world.Unload()
+	GlobalRNG = NewRNG(1)
+	GlobalMessages = NewMessages()
+	player := makeEntity(2, 1, '@')
+	player.StartAI("player")
+	top.RegisterEntity(player)
+	session := &Session{Name: "bob", Player: player}
+
+	gameLoop = NewGameLoop()
+	gameLoop.publish()
+	player.SetHealth(Health{HP: 3, MaxHP: 10})
+	if got, want := lobbyLine(0, session), "1      watch bob, level 1, HP 10/10"; got != want {
+		t.Errorf("lobby line before publishing is %q, want %q", got, want)
+	}
+	gameLoop.publish()
+	if got, want := lobbyLine(0, session), "1      watch bob, level 1, HP 3/10"; got != want {
+		t.Errorf("lobby line after publishing is %q, want %q", got, want)
+	}
+	player.Perform(Decision{"Climb", ClimbDown})
+	if got, want := lobbyLine(0, session), "1      watch bob, on the stairs"; got != want {
+		t.Errorf("lobby line before the new level's published is %q, want %q", got, want)
+	}
+}
+
+// Levels below the top take turns between generators, unless -generate
+// picks one for them all.
+func TestWorld_Generator(t *testing.T) {
+	if err := LoadItemDefs(*itemsPath); err != nil {
+		t.Fatal(err)
+	}
+	defer func(g string) { *generator = g }(*generator)
+	for _, test := range []struct {
+		generator string
+		want      []string
+	}{
+		{"", deeperGenerators},
+		{"islands", []string{"islands", "islands"}},
+	} {
+		*generator = test.generator
+		mf, err := ParseMapFile(strings.NewReader(worldTestMap))
+		if err != nil {
+			t.Fatal(err)
+		}
+		top, err := mf.NewLevel()
+		if err != nil {
+			t.Fatal(err)
+		}
+		world = NewWorld(top, 1)
+		GlobalRNG = NewRNG(1)
+		GlobalMessages = NewMessages()
+		for i, want := range test.want {
+			l, err := world.Level(i + 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(l.Name, want+" ") {
+				t.Errorf("-generate %q: level %v is %q, want one made by %v", test.generator, i+1, l.Name, want)
+			}
+		}
+		world.Unload()
+	}
+}